@@ -3,16 +3,59 @@ package ast
 import (
 	"fmt"
 	"interpreter/token"
+	"strconv"
+	"strings"
 )
 
+type Node interface {
+    ToString() string
+    Pos() token.Position
+}
+
+// Program is the root of every parsed source.
+type Program struct {
+    Statements []Statement
+    // Comments holds the comments found around each node, when the lexer
+    // was asked to keep them. The program's own entry holds the comments
+    // at the end of the source.
+    Comments map[Node]*Trivia
+    // BlankLines holds the offsets of the statements and comments that had
+    // a blank line before them, kept along with the comments.
+    BlankLines map[uint32]bool
+}
+
+// Trivia is the comments attached to a node. Leading comments come before
+// a statement or an operand. Trailing ones come after a statement, or
+// inside it where there is no closer node for them, after an element of a
+// list or hash, or between an if's consequence and its else. Inner comments
+// sit before the closing '}' of a block, or at the end of a program.
+type Trivia struct {
+    Leading []token.Token
+    Trailing []token.Token
+    Inner []token.Token
+}
+func (p *Program) Pos() token.Position {
+    if len(p.Statements) == 0 {
+        return token.Position{ Line: 1, Column: 1 }
+    }
+    return p.Statements[0].Pos()
+}
+func (p *Program) ToString() string {
+    stmts := make([]string, len(p.Statements))
+    for i,stmt := range p.Statements {
+        stmts[i] = stmt.ToString()
+    }
+    return strings.Join(stmts, "\n")
+}
+
 type Statement interface {
+    Node
     statementInf()
-    ToString() string
 }
 
 type Expression interface {
+    Node
     expressionInf()
-    ToString() string
 }
 
 
@@ -23,6 +66,7 @@ type LetStatement struct {
     Value Expression
 }
 func(l *LetStatement) statementInf() {}
+func (l *LetStatement) Pos() token.Position { return l.Token.Start }
 func (l *LetStatement) ToString() string { 
     return fmt.Sprintf(
         "let stmt:: ident:%s value:%s",
@@ -36,6 +80,7 @@ type ReturnStatement struct {
     Value Expression
 }
 func(l *ReturnStatement) statementInf() {}
+func (l *ReturnStatement) Pos() token.Position { return l.Token.Start }
 func (l *ReturnStatement) ToString() string { 
     return fmt.Sprintf(
         "return stmt:: value:%s",
@@ -48,12 +93,27 @@ type ExpressionStatement struct {
     Value Expression
 }
 func(l *ExpressionStatement) statementInf() {}
+func (l *ExpressionStatement) Pos() token.Position { return l.Token.Start }
 func (l *ExpressionStatement) ToString() string { 
     return fmt.Sprintf(
         "expression stmt:: value:%s",
         l.Value.ToString(),
     )
 }
+
+type BlockStatement struct {
+    Token token.Token
+    Statements []Statement
+}
+func (b *BlockStatement) statementInf() {}
+func (b *BlockStatement) Pos() token.Position { return b.Token.Start }
+func (b *BlockStatement) ToString() string {
+    stmts := make([]string, len(b.Statements))
+    for i,stmt := range b.Statements {
+        stmts[i] = stmt.ToString()
+    }
+    return fmt.Sprintf("{%s}", strings.Join(stmts, " "))
+}
 //}}}
 
 // Expressions {{{
@@ -62,6 +122,7 @@ type Identifier struct {
     Value string
 }
 func (i *Identifier) expressionInf() {}
+func (i *Identifier) Pos() token.Position { return i.Token.Start }
 func (i *Identifier) ToString() string {
     return i.Value 
 }
@@ -71,6 +132,7 @@ type IntLiteral struct {
     Value int64
 }
 func (i *IntLiteral) expressionInf() {}
+func (i *IntLiteral) Pos() token.Position { return i.Token.Start }
 func (i *IntLiteral) ToString() string {
     return fmt.Sprintf("%d", i.Value)
 }
@@ -80,16 +142,62 @@ type BoolLiteral struct {
     Value bool
 }
 func (b *BoolLiteral) expressionInf() {}
+func (b *BoolLiteral) Pos() token.Position { return b.Token.Start }
 func (b *BoolLiteral) ToString() string {
     return fmt.Sprintf("%t", b.Value)
 }
 
+type StringLiteral struct {
+    Token token.Token
+    Value string
+}
+func (s *StringLiteral) expressionInf() {}
+func (s *StringLiteral) Pos() token.Position { return s.Token.Start }
+func (s *StringLiteral) ToString() string {
+    return strconv.Quote(s.Value)
+}
+
+type ArrayLiteral struct {
+    Token token.Token
+    Elements []Expression
+}
+func (a *ArrayLiteral) expressionInf() {}
+func (a *ArrayLiteral) Pos() token.Position { return a.Token.Start }
+func (a *ArrayLiteral) ToString() string {
+    elems := make([]string, len(a.Elements))
+    for i,e := range a.Elements {
+        elems[i] = e.ToString()
+    }
+    return fmt.Sprintf("[%s]", strings.Join(elems, ", "))
+}
+
+type HashPair struct {
+    Key Expression
+    Value Expression
+}
+
+// HashLiteral keeps its pairs in source order, so printing it is stable.
+type HashLiteral struct {
+    Token token.Token
+    Pairs []HashPair
+}
+func (h *HashLiteral) expressionInf() {}
+func (h *HashLiteral) Pos() token.Position { return h.Token.Start }
+func (h *HashLiteral) ToString() string {
+    pairs := make([]string, len(h.Pairs))
+    for i,p := range h.Pairs {
+        pairs[i] = fmt.Sprintf("%s: %s", p.Key.ToString(), p.Value.ToString())
+    }
+    return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
 type PrefixExpression struct {
     Token token.Token
     Opperator string
     Right Expression
 }
 func (p *PrefixExpression) expressionInf() {}
+func (p *PrefixExpression) Pos() token.Position { return p.Token.Start }
 func (p *PrefixExpression) ToString() string {
     return fmt.Sprintf("(%s%s)", p.Opperator, p.Right.ToString())
 }
@@ -101,7 +209,69 @@ type InfixExpression struct {
     Right Expression
 }
 func (i *InfixExpression) expressionInf() {}
+func (i *InfixExpression) Pos() token.Position { return i.Token.Start }
 func (i *InfixExpression) ToString() string {
     return fmt.Sprintf("(%s %s %s)", i.Left.ToString(), i.Opperator, i.Right.ToString())
 }
+
+type FunctionLiteral struct {
+    Token token.Token
+    Parameters []*Identifier
+    Body *BlockStatement
+}
+func (f *FunctionLiteral) expressionInf() {}
+func (f *FunctionLiteral) Pos() token.Position { return f.Token.Start }
+func (f *FunctionLiteral) ToString() string {
+    params := make([]string, len(f.Parameters))
+    for i,p := range f.Parameters {
+        params[i] = p.ToString()
+    }
+    return fmt.Sprintf("fn(%s) %s", strings.Join(params, ", "), f.Body.ToString())
+}
+
+type IfExpression struct {
+    Token token.Token
+    Condition Expression
+    Consequence *BlockStatement
+    Alternative *BlockStatement
+}
+func (i *IfExpression) expressionInf() {}
+func (i *IfExpression) Pos() token.Position { return i.Token.Start }
+func (i *IfExpression) ToString() string {
+    if i.Alternative == nil {
+        return fmt.Sprintf("if %s %s", i.Condition.ToString(), i.Consequence.ToString())
+    }
+    return fmt.Sprintf(
+        "if %s %s else %s",
+        i.Condition.ToString(),
+        i.Consequence.ToString(),
+        i.Alternative.ToString(),
+    )
+}
+
+type IndexExpression struct {
+    Token token.Token
+    Left Expression
+    Index Expression
+}
+func (i *IndexExpression) expressionInf() {}
+func (i *IndexExpression) Pos() token.Position { return i.Token.Start }
+func (i *IndexExpression) ToString() string {
+    return fmt.Sprintf("(%s[%s])", i.Left.ToString(), i.Index.ToString())
+}
+
+type CallExpression struct {
+    Token token.Token
+    Function Expression
+    Arguments []Expression
+}
+func (c *CallExpression) expressionInf() {}
+func (c *CallExpression) Pos() token.Position { return c.Token.Start }
+func (c *CallExpression) ToString() string {
+    args := make([]string, len(c.Arguments))
+    for i,a := range c.Arguments {
+        args[i] = a.ToString()
+    }
+    return fmt.Sprintf("%s(%s)", c.Function.ToString(), strings.Join(args, ", "))
+}
 //}}}
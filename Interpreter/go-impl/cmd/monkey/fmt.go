@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/printer"
+	"io"
+	"os"
+)
+
+// fmtFiles rewrites every file in its canonical form. With -check it only
+// lists the files that aren't formatted, and fails if there are any, which
+// suits a pre-commit hook. It returns the process exit code.
+func fmtFiles(args []string, stdout io.Writer, stderr io.Writer) int {
+    flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    check := flags.Bool("check", false, "list unformatted files instead of rewriting them")
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+    if flags.NArg() == 0 {
+        fmt.Fprint(stderr, usage)
+        return 2
+    }
+
+    code := 0
+    for _,path := range flags.Args() {
+        src,err := os.ReadFile(path)
+        if err != nil {
+            fmt.Fprintf(stderr, "%s\n", err)
+            code = 1
+            continue
+        }
+
+        lex := lexer.NewFile(path, src)
+        lex.KeepComments(true)
+        p := parser.New(&lex)
+        program,errs := p.ParseProgram()
+        if len(errs) > 0 {
+            for _,e := range errs {
+                fmt.Fprintf(stderr, "%s\n", e.Error())
+            }
+            code = 1
+            continue
+        }
+
+        formatted := []byte(printer.Print(program))
+        if bytes.Equal(src, formatted) {
+            continue
+        }
+        if *check {
+            fmt.Fprintln(stdout, path)
+            code = 1
+            continue
+        }
+        // keep the file's mode, as gofmt does
+        info,err := os.Stat(path)
+        if err == nil {
+            err = os.WriteFile(path, formatted, info.Mode().Perm())
+        }
+        if err != nil {
+            fmt.Fprintf(stderr, "%s\n", err)
+            code = 1
+        }
+    }
+    return code
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmtFiles(t *testing.T) {
+    dir := t.TempDir()
+    messy := filepath.Join(dir, "messy.monkey")
+    clean := filepath.Join(dir, "clean.monkey")
+    os.WriteFile(messy, []byte("let a=1 ;a+  2;"), 0o600)
+    os.WriteFile(clean, []byte("let a = 1;\n\n// sum\na + 2;\n"), 0o644)
+
+    var stdout, stderr bytes.Buffer
+    if code := fmtFiles([]string{ "-check", messy, clean }, &stdout, &stderr); code != 1 {
+        t.Fatalf("Expected exit:1 got:%d", code)
+    }
+    if stdout.String() != messy + "\n" {
+        t.Fatalf("Expected stdout:%q got:%q", messy + "\n", stdout.String())
+    }
+
+    stdout.Reset()
+    if code := fmtFiles([]string{ messy, clean }, &stdout, &stderr); code != 0 {
+        t.Fatalf("Expected exit:0 got:%d (%s)", code, stderr.String())
+    }
+    src,_ := os.ReadFile(messy)
+    if string(src) != "let a = 1;\na + 2;\n" {
+        t.Fatalf("Expected file:%q got:%q", "let a = 1;\na + 2;\n", src)
+    }
+    if info,_ := os.Stat(messy); info.Mode().Perm() != 0o600 {
+        t.Fatalf("Expected mode:0600 got:%o", info.Mode().Perm())
+    }
+
+    if code := fmtFiles([]string{ "-check", messy, clean }, &stdout, &stderr); code != 0 {
+        t.Fatalf("Expected exit:0 got:%d", code)
+    }
+}
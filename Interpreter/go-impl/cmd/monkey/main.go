@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"interpreter/repl"
+	"os"
+)
+
+const usage = `usage:
+    monkey              start the interactive REPL
+    monkey run [-engine=eval|vm] <file>
+                        run a script file, walking its tree or compiling
+                        it to bytecode for the vm
+    monkey fmt [-check] <file>...
+                        rewrite files in canonical form, or with -check
+                        list the files that would change
+`
+
+func main() {
+    if len(os.Args) < 2 {
+        repl.Start(os.Stdin, os.Stdout)
+        return
+    }
+
+    switch os.Args[1] {
+        case "run": os.Exit(runCommand(os.Args[2:], os.Stdout, os.Stderr))
+        case "fmt": os.Exit(fmtFiles(os.Args[2:], os.Stdout, os.Stderr))
+        default: {
+            fmt.Fprint(os.Stderr, usage)
+            os.Exit(2)
+        }
+    }
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/vm"
+	"io"
+	"os"
+)
+
+// runCommand reads the flags of the run command and runs the file named
+// after them. It returns the process exit code.
+func runCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+    flags := flag.NewFlagSet("run", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    engine := flags.String("engine", "eval", "execution engine, eval or vm")
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+    if flags.NArg() != 1 || (*engine != "eval" && *engine != "vm") {
+        fmt.Fprint(stderr, usage)
+        return 2
+    }
+    return runFile(flags.Arg(0), *engine, stdout, stderr)
+}
+
+// runFile parses the whole script before evaluating any of it, so a file
+// with syntax errors never runs half way. engine picks between walking the
+// tree and compiling it for the vm. It returns the process exit code.
+func runFile(path string, engine string, stdout io.Writer, stderr io.Writer) int {
+    src,err := os.ReadFile(path)
+    if err != nil {
+        fmt.Fprintf(stderr, "%s\n", err)
+        return 1
+    }
+
+    lex := lexer.NewFile(path, src)
+    p := parser.New(&lex)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        for _,e := range errs {
+            fmt.Fprintf(stderr, "%s\n", e.Error())
+        }
+        return 1
+    }
+
+    var res object.Object
+    if engine == "vm" {
+        res,err = runVM(program)
+        if err != nil {
+            reportRuntimeError(stderr, path, err)
+            return 1
+        }
+    } else {
+        res = evaluator.Eval(program, object.NewEnvironment())
+        if e,ok := res.(*object.Error); ok {
+            reportRuntimeError(stderr, path, e)
+            return 1
+        }
+    }
+    if res.Type() != object.Obj_null {
+        fmt.Fprintln(stdout, res.Inspect())
+    }
+    return 0
+}
+
+// reportRuntimeError prints err, which may also be a compile error from
+// the vm engine. An error that carries a position already names the file,
+// so only one without a position is given the file name.
+func reportRuntimeError(stderr io.Writer, path string, err error) {
+    var e *object.Error
+    var cerr *compiler.Error
+    if (errors.As(err, &e) && e.Pos.Line != 0) || errors.As(err, &cerr) {
+        fmt.Fprintf(stderr, "%s\n", err)
+        return
+    }
+    fmt.Fprintf(stderr, "%s: %s\n", path, err)
+}
+
+func runVM(program *ast.Program) (object.Object, error) {
+    c := compiler.New()
+    if err := c.Compile(program); err != nil {
+        return nil, err
+    }
+    machine := vm.New(c.Bytecode())
+    if err := machine.Run(); err != nil {
+        return nil, err
+    }
+    return machine.LastPoppedStackElem(), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFile(t *testing.T) {
+    tests := []struct {
+        src string
+        code int
+        stdout string
+        stderr string
+    } {
+        { "let a = 2; let b = a * 3; b + 1;", 0, "7\n", "" },
+        { "let a = 2;", 0, "2\n", "" },
+        { "5 +; 6 *;", 1, "", "%[1]s:1:4: invalid syntax: unexpected ';'\n%[1]s:1:9: invalid syntax: unexpected ';'\n" },
+        { "1 + true;", 1, "", "%[1]s:1:3: type mismatch: INTEGER + BOOLEAN\n" },
+        { "let a = 10;\na / (a - 10);", 1, "", "%[1]s:2:3: division by zero: 10 / 0\n" },
+        { "len(1);", 1, "", "%[1]s: argument to `len` must be STRING or ARRAY, got INTEGER\n" },
+        { "let f = fn(n) { if (n < 2) { return n; } f(n - 1) + f(n - 2) }; f(10);", 0, "55\n", "" },
+    }
+
+    dir := t.TempDir()
+    path := filepath.Join(dir, "prog.monkey")
+    for _,test := range tests {
+        if err := os.WriteFile(path, []byte(test.src), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        for _,engine := range []string{ "eval", "vm" } {
+            var stdout, stderr bytes.Buffer
+            code := runCommand([]string{ "-engine=" + engine, path }, &stdout, &stderr)
+            if code != test.code {
+                t.Fatalf("%s: Expected exit:%d got:%d", engine, test.code, code)
+            }
+            if stdout.String() != test.stdout {
+                t.Fatalf("%s: Expected stdout:%q got:%q", engine, test.stdout, stdout.String())
+            }
+            expectedErr := test.stderr
+            if expectedErr != "" {
+                expectedErr = fmt.Sprintf(expectedErr, path)
+            }
+            if stderr.String() != expectedErr {
+                t.Fatalf("%s: Expected stderr:%q got:%q", engine, expectedErr, stderr.String())
+            }
+        }
+    }
+
+    // a compile error already carries the file name
+    src := "len(" + strings.Repeat("1, ", 256) + "1);"
+    if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    var stdout, stderr bytes.Buffer
+    if code := runCommand([]string{ "-engine=vm", path }, &stdout, &stderr); code != 1 {
+        t.Fatalf("Expected exit:1 got:%d", code)
+    }
+    if expected := path + ":1:4: too many arguments\n"; stderr.String() != expected {
+        t.Fatalf("Expected stderr:%q got:%q", expected, stderr.String())
+    }
+
+    stdout.Reset()
+    stderr.Reset()
+    if code := runCommand([]string{ "--engine=jit", path }, &stdout, &stderr); code != 2 {
+        t.Fatalf("Expected exit:2 for an unknown engine, got:%d", code)
+    }
+}
@@ -0,0 +1,202 @@
+// Package code defines the bytecode the compiler emits and the vm runs.
+// An instruction is a one byte opcode followed by its operands, each
+// stored big endian in the width its definition gives.
+package code
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+    Op_constant Opcode = iota
+    Op_pop
+    Op_true
+    Op_false
+    Op_null
+
+    Op_add
+    Op_sub
+    Op_mul
+    Op_div
+    Op_equal
+    Op_notEqual
+    Op_lessThan
+    Op_greaterThan
+    Op_minus
+    Op_bang
+
+    Op_jump
+    Op_jumpNotTruthy
+
+    Op_getGlobal
+    Op_setGlobal
+    Op_getLocal
+    Op_setLocal
+    Op_getName
+    Op_array
+    Op_hash
+    Op_index
+
+    Op_closure
+    Op_call
+    Op_returnValue
+)
+
+// Definition describes an opcode: its name in disassembly, and the width in
+// bytes of each of its operands.
+type Definition struct {
+    Name string
+    OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition {
+    Op_constant: { "Op_constant", []int{2} },
+    Op_pop: { "Op_pop", []int{} },
+    Op_true: { "Op_true", []int{} },
+    Op_false: { "Op_false", []int{} },
+    Op_null: { "Op_null", []int{} },
+
+    Op_add: { "Op_add", []int{} },
+    Op_sub: { "Op_sub", []int{} },
+    Op_mul: { "Op_mul", []int{} },
+    Op_div: { "Op_div", []int{} },
+    Op_equal: { "Op_equal", []int{} },
+    Op_notEqual: { "Op_notEqual", []int{} },
+    Op_lessThan: { "Op_lessThan", []int{} },
+    Op_greaterThan: { "Op_greaterThan", []int{} },
+    Op_minus: { "Op_minus", []int{} },
+    Op_bang: { "Op_bang", []int{} },
+
+    // the offset to jump to
+    Op_jump: { "Op_jump", []int{2} },
+    Op_jumpNotTruthy: { "Op_jumpNotTruthy", []int{2} },
+
+    Op_getGlobal: { "Op_getGlobal", []int{2} },
+    Op_setGlobal: { "Op_setGlobal", []int{2} },
+    Op_getLocal: { "Op_getLocal", []int{1} },
+    Op_setLocal: { "Op_setLocal", []int{1} },
+    // the index of the name in the function's refs
+    Op_getName: { "Op_getName", []int{2} },
+    // the number of elements, or of keys and values for a hash
+    Op_array: { "Op_array", []int{2} },
+    Op_hash: { "Op_hash", []int{2} },
+    Op_index: { "Op_index", []int{} },
+
+    // the constant holding the function
+    Op_closure: { "Op_closure", []int{2} },
+    // the number of arguments
+    Op_call: { "Op_call", []int{1} },
+    Op_returnValue: { "Op_returnValue", []int{} },
+}
+
+func Lookup(op byte) (*Definition, error) {
+    def,ok := definitions[Opcode(op)]
+    if !ok {
+        return nil, fmt.Errorf("opcode %d undefined", op)
+    }
+    return def, nil
+}
+
+// CheckOperands fails if op is unknown, or if an operand doesn't fit the
+// width its definition gives it.
+func CheckOperands(op Opcode, operands ...int) error {
+    def,ok := definitions[op]
+    if !ok {
+        return fmt.Errorf("opcode %d undefined", op)
+    }
+    for i,o := range operands {
+        if i >= len(def.OperandWidths) {
+            return fmt.Errorf("too many operands for %s", def.Name)
+        }
+        max := 1<<(8*def.OperandWidths[i]) - 1
+        if o < 0 || o > max {
+            return fmt.Errorf("operand %d of %s out of range: %d", i, def.Name, o)
+        }
+    }
+    return nil
+}
+
+// Make encodes one instruction. It returns nothing for an unknown opcode,
+// or for an operand that CheckOperands rejects, rather than truncate it.
+func Make(op Opcode, operands ...int) []byte {
+    def,ok := definitions[op]
+    if !ok || CheckOperands(op, operands...) != nil {
+        return []byte{}
+    }
+
+    length := 1
+    for _,w := range def.OperandWidths {
+        length += w
+    }
+    ins := make([]byte, length)
+    ins[0] = byte(op)
+
+    offset := 1
+    for i,o := range operands {
+        switch def.OperandWidths[i] {
+            case 1: ins[offset] = byte(o)
+            case 2: binary.BigEndian.PutUint16(ins[offset:], uint16(o))
+        }
+        offset += def.OperandWidths[i]
+    }
+    return ins
+}
+
+// ReadOperands decodes the operands of an instruction whose opcode has
+// already been read, and returns them with the number of bytes they took.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+    operands := make([]int, len(def.OperandWidths))
+    offset := 0
+    for i,w := range def.OperandWidths {
+        switch w {
+            case 1: operands[i] = int(ReadUint8(ins[offset:]))
+            case 2: operands[i] = int(ReadUint16(ins[offset:]))
+        }
+        offset += w
+    }
+    return operands, offset
+}
+
+func ReadUint8(ins Instructions) uint8 {
+    return uint8(ins[0])
+}
+
+func ReadUint16(ins Instructions) uint16 {
+    return binary.BigEndian.Uint16(ins)
+}
+
+// String disassembles the instructions, one per line, each prefixed with
+// its offset.
+func (ins Instructions) String() string {
+    var sb strings.Builder
+    i := 0
+    for i < len(ins) {
+        def,err := Lookup(ins[i])
+        if err != nil {
+            fmt.Fprintf(&sb, "ERROR: %s\n", err)
+            i++
+            continue
+        }
+        operands,read := ReadOperands(def, ins[i+1:])
+        fmt.Fprintf(&sb, "%04d %s\n", i, formatInstruction(def, operands))
+        i += 1 + read
+    }
+    return sb.String()
+}
+
+func formatInstruction(def *Definition, operands []int) string {
+    if len(operands) != len(def.OperandWidths) {
+        return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+    }
+    res := []string{ def.Name }
+    for _,o := range operands {
+        res = append(res, fmt.Sprint(o))
+    }
+    return strings.Join(res, " ")
+}
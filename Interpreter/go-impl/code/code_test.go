@@ -0,0 +1,82 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+    tests := []struct {
+        op Opcode
+        operands []int
+        expected []byte
+    } {
+        { Op_constant, []int{ 65534 }, []byte{ byte(Op_constant), 255, 254 } },
+        { Op_add, []int{}, []byte{ byte(Op_add) } },
+        { Op_getGlobal, []int{ 258 }, []byte{ byte(Op_getGlobal), 1, 2 } },
+        { Op_getLocal, []int{ 255 }, []byte{ byte(Op_getLocal), 255 } },
+        { Op_closure, []int{ 65534 }, []byte{ byte(Op_closure), 255, 254 } },
+        // an operand too wide for its slot is refused, not truncated
+        { Op_jump, []int{ 65536 }, []byte{} },
+        { Op_getLocal, []int{ 256 }, []byte{} },
+        { Op_constant, []int{ -1 }, []byte{} },
+    }
+
+    for _,test := range tests {
+        ins := Make(test.op, test.operands...)
+        if len(ins) != len(test.expected) {
+            t.Fatalf("Expected %d bytes, got:%d", len(test.expected), len(ins))
+        }
+        for i,b := range test.expected {
+            if ins[i] != b {
+                t.Fatalf("Expected byte %d to be %d, got:%d", i, b, ins[i])
+            }
+        }
+    }
+}
+
+func TestReadOperands(t *testing.T) {
+    tests := []struct {
+        op Opcode
+        operands []int
+        read int
+    } {
+        { Op_constant, []int{ 65535 }, 2 },
+        { Op_pop, []int{}, 0 },
+        { Op_getLocal, []int{ 255 }, 1 },
+        { Op_getName, []int{ 65535 }, 2 },
+    }
+
+    for _,test := range tests {
+        ins := Make(test.op, test.operands...)
+        def,err := Lookup(byte(test.op))
+        if err != nil {
+            t.Fatalf("definition not found: %s", err)
+        }
+        operands,read := ReadOperands(def, ins[1:])
+        if read != test.read {
+            t.Fatalf("Expected to read %d bytes, got:%d", test.read, read)
+        }
+        for i,o := range test.operands {
+            if operands[i] != o {
+                t.Fatalf("Expected operand %d to be %d, got:%d", i, o, operands[i])
+            }
+        }
+    }
+}
+
+func TestInstructionsString(t *testing.T) {
+    ins := Instructions{}
+    for _,i := range [][]byte{
+        Make(Op_add),
+        Make(Op_constant, 2),
+        Make(Op_constant, 65535),
+        Make(Op_setGlobal, 1),
+        Make(Op_getLocal, 1),
+        Make(Op_closure, 65535),
+    } {
+        ins = append(ins, i...)
+    }
+
+    expected := "0000 Op_add\n0001 Op_constant 2\n0004 Op_constant 65535\n0007 Op_setGlobal 1\n0010 Op_getLocal 1\n0012 Op_closure 65535\n"
+    if ins.String() != expected {
+        t.Fatalf("Expected:%q got:%q", expected, ins.String())
+    }
+}
@@ -0,0 +1,530 @@
+// Package compiler turns a syntax tree into bytecode for the vm, along with
+// the pool of constants the bytecode refers to.
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/object"
+	"interpreter/token"
+	"math"
+)
+
+type Compiler struct {
+    constants []object.Object
+    symbols *SymbolTable
+    // the function being compiled, innermost last
+    scopes []scope
+    // err is the first instruction that couldn't be encoded, waiting for
+    // Compile to report it against the node it came from
+    err error
+}
+
+// scope is the code of one function as it is being compiled.
+type scope struct {
+    instructions code.Instructions
+    operators map[int]token.Token
+    // params is how many of the function's locals are its parameters
+    params int
+    refs []object.Ref
+    // refIndex maps a name to its index in refs
+    refIndex map[string]int
+}
+
+// Bytecode is everything the vm needs to run a compiled program.
+type Bytecode struct {
+    Instructions code.Instructions
+    Constants []object.Object
+    // Globals names each global slot, for reporting unbound names.
+    Globals []string
+    // Operators maps the offset of each operator instruction to the token
+    // it was compiled from, for locating runtime errors.
+    Operators map[int]token.Token
+}
+
+func New() *Compiler {
+    return &Compiler{
+        constants: []object.Object{},
+        symbols: NewSymbolTable(),
+        scopes: []scope{ newScope() },
+    }
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+    return &Bytecode{
+        Instructions: c.scopes[0].instructions,
+        Constants: c.constants,
+        Globals: c.symbols.global().Names(),
+        Operators: c.scopes[0].operators,
+    }
+}
+
+// Error is a program the compiler can't turn into bytecode, located at
+// the node it failed on.
+type Error struct {
+    Message string
+    Pos token.Position
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func errorAt(node ast.Node, format string, a ...any) *Error {
+    return &Error{ Message: fmt.Sprintf(format, a...), Pos: node.Pos() }
+}
+
+// Compile compiles node. Every error it returns is an *Error, located at
+// the innermost node that failed, including an instruction emitted with an
+// operand too large to encode.
+func (c *Compiler) Compile(node ast.Node) error {
+    // an error from before node started belongs to the node around it
+    pending := c.err != nil
+    if err := c.compile(node); err != nil {
+        var cerr *Error
+        if !errors.As(err, &cerr) {
+            err = errorAt(node, "%s", err)
+        }
+        return err
+    }
+    if c.err != nil && !pending {
+        err := errorAt(node, "%s", c.err)
+        c.err = nil
+        return err
+    }
+    return nil
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+    switch node := node.(type) {
+        case *ast.Program: {
+            for _,stmt := range node.Statements {
+                if err := c.Compile(stmt); err != nil {
+                    return err
+                }
+            }
+        }
+
+        // statements
+        case *ast.LetStatement: return c.compileLetStatement(node)
+        case *ast.ReturnStatement: {
+            if err := c.Compile(node.Value); err != nil {
+                return err
+            }
+            c.emit(code.Op_returnValue)
+        }
+        case *ast.ExpressionStatement: {
+            if err := c.Compile(node.Value); err != nil {
+                return err
+            }
+            c.emit(code.Op_pop)
+        }
+
+        // expressions
+        case *ast.IntLiteral: return c.emitConstant(&object.Integer{ Value: node.Value })
+        case *ast.StringLiteral: return c.emitConstant(&object.String{ Value: node.Value })
+        case *ast.BoolLiteral: {
+            if node.Value {
+                c.emit(code.Op_true)
+            } else {
+                c.emit(code.Op_false)
+            }
+        }
+        case *ast.Identifier: return c.compileIdentifier(node)
+        case *ast.PrefixExpression: return c.compilePrefixExpression(node)
+        case *ast.InfixExpression: return c.compileInfixExpression(node)
+        case *ast.IfExpression: return c.compileIfExpression(node)
+        case *ast.FunctionLiteral: return c.compileFunctionLiteral(node)
+        case *ast.CallExpression: {
+            if err := c.Compile(node.Function); err != nil {
+                return err
+            }
+            if err := c.compileExpressions(node.Arguments); err != nil {
+                return err
+            }
+            if len(node.Arguments) > math.MaxUint8 {
+                return errorAt(node, "too many arguments")
+            }
+            c.emit(code.Op_call, len(node.Arguments))
+        }
+        case *ast.ArrayLiteral: {
+            if err := c.compileExpressions(node.Elements); err != nil {
+                return err
+            }
+            if len(node.Elements) > math.MaxUint16 {
+                return errorAt(node, "too many elements")
+            }
+            c.emit(code.Op_array, len(node.Elements))
+        }
+        case *ast.HashLiteral: {
+            for _,pair := range node.Pairs {
+                if err := c.Compile(pair.Key); err != nil {
+                    return err
+                }
+                if err := c.Compile(pair.Value); err != nil {
+                    return err
+                }
+            }
+            if 2*len(node.Pairs) > math.MaxUint16 {
+                return errorAt(node, "too many pairs")
+            }
+            c.emit(code.Op_hash, 2*len(node.Pairs))
+        }
+        case *ast.IndexExpression: {
+            if err := c.Compile(node.Left); err != nil {
+                return err
+            }
+            if err := c.Compile(node.Index); err != nil {
+                return err
+            }
+            c.emit(code.Op_index)
+        }
+
+        default: return errorAt(node, "cannot compile node: %s", node.ToString())
+    }
+    return nil
+}
+
+// compile statements {{{
+// compileLetStatement binds the name only once the value is computed. A
+// local's slot stays unbound until then, so "let x = x + 1" reads the x
+// from before, like the evaluator does.
+func (c *Compiler) compileLetStatement(stmt *ast.LetStatement) error {
+    ident,ok := stmt.Identifier.(*ast.Identifier)
+    if !ok {
+        return errorAt(stmt, "invalid let target: %s", stmt.Identifier.ToString())
+    }
+    if err := c.Compile(stmt.Value); err != nil {
+        return err
+    }
+    sym := c.symbols.Define(ident.Value)
+    if sym.Scope == Scope_local {
+        c.emit(code.Op_setLocal, sym.Index)
+        return nil
+    }
+    if sym.Index > math.MaxUint16 {
+        return errorAt(stmt, "too many global bindings")
+    }
+    c.emit(code.Op_setGlobal, sym.Index)
+    return nil
+}
+
+// compileBlock leaves the value of the block on the stack: the value of its
+// last statement, or null if it is empty.
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+    if len(block.Statements) == 0 {
+        c.emit(code.Op_null)
+        return nil
+    }
+    last := len(block.Statements)-1
+    for _,stmt := range block.Statements[:last] {
+        if err := c.Compile(stmt); err != nil {
+            return err
+        }
+    }
+
+    switch stmt := block.Statements[last].(type) {
+        case *ast.ExpressionStatement: return c.Compile(stmt.Value)
+        case *ast.LetStatement: {
+            if err := c.Compile(stmt); err != nil {
+                return err
+            }
+            sym,_ := c.symbols.Resolve(stmt.Identifier.(*ast.Identifier).Value)
+            c.loadSymbol(sym)
+            return nil
+        }
+    }
+    // a return leaves nothing behind, but nothing runs after it either
+    return c.Compile(block.Statements[last])
+}
+// }}}
+
+// compile expressions {{{
+// compileIdentifier reads a name in the order the evaluator looks it up:
+// the calls in progress from the innermost out, then the globals, then the
+// builtins. Which of those binds the name can change as the program runs,
+// since a let in an enclosing function may not have run yet, or may run
+// again. So a name that any enclosing function binds is read with
+// Op_getName, and the vm picks the first bound slot of its ref. Only a
+// parameter of the current function is always bound, and it is read
+// directly. Any other name is given a global slot, and the vm falls back
+// to the builtins when nothing is bound to it by the time it is read.
+func (c *Compiler) compileIdentifier(ident *ast.Identifier) error {
+    slots := c.symbols.Locate(ident.Value)
+    if len(slots) > 0 && slots[0].Depth == 0 && slots[0].Index < c.scope().params {
+        c.emit(code.Op_getLocal, slots[0].Index)
+        return nil
+    }
+    global := c.symbols.global().Define(ident.Value)
+    if global.Index > math.MaxUint16 {
+        return errorAt(ident, "too many global bindings")
+    }
+    if len(slots) == 0 {
+        c.emit(code.Op_getGlobal, global.Index)
+        return nil
+    }
+
+    index,ok := c.scope().refIndex[ident.Value]
+    if !ok {
+        if len(c.scope().refs) > math.MaxUint16 {
+            return errorAt(ident, "too many names")
+        }
+        index = len(c.scope().refs)
+        c.scope().refs = append(c.scope().refs, object.Ref{ Name: ident.Value, Slots: slots, Global: global.Index })
+        c.scope().refIndex[ident.Value] = index
+    }
+    c.emit(code.Op_getName, index)
+    return nil
+}
+
+// loadSymbol pushes the value bound to a symbol of the current scope, which
+// must already be bound.
+func (c *Compiler) loadSymbol(sym Symbol) {
+    switch sym.Scope {
+        case Scope_global: c.emit(code.Op_getGlobal, sym.Index)
+        case Scope_local: c.emit(code.Op_getLocal, sym.Index)
+    }
+}
+
+func (c *Compiler) compilePrefixExpression(expr *ast.PrefixExpression) error {
+    if err := c.Compile(expr.Right); err != nil {
+        return err
+    }
+    switch expr.Opperator {
+        case "!": c.emitOperator(expr.Token, code.Op_bang)
+        case "-": c.emitOperator(expr.Token, code.Op_minus)
+        default: return errorAt(expr, "unknown operator: %s", expr.Opperator)
+    }
+    return nil
+}
+
+var infixOps = map[string]code.Opcode {
+    "+": code.Op_add,
+    "-": code.Op_sub,
+    "*": code.Op_mul,
+    "/": code.Op_div,
+    "==": code.Op_equal,
+    "!=": code.Op_notEqual,
+    "<": code.Op_lessThan,
+    ">": code.Op_greaterThan,
+}
+
+func (c *Compiler) compileInfixExpression(expr *ast.InfixExpression) error {
+    op,ok := infixOps[expr.Opperator]
+    if !ok {
+        return errorAt(expr, "unknown operator: %s", expr.Opperator)
+    }
+    if err := c.Compile(expr.Left); err != nil {
+        return err
+    }
+    if err := c.Compile(expr.Right); err != nil {
+        return err
+    }
+    c.emitOperator(expr.Token, op)
+    return nil
+}
+
+// compileIfExpression jumps over the consequence when the condition fails.
+// A missing alternative evaluates to null.
+func (c *Compiler) compileIfExpression(expr *ast.IfExpression) error {
+    if err := c.Compile(expr.Condition); err != nil {
+        return err
+    }
+    jumpNotTruthy := c.emit(code.Op_jumpNotTruthy, 0)
+    if err := c.compileBlock(expr.Consequence); err != nil {
+        return err
+    }
+    jump := c.emit(code.Op_jump, 0)
+
+    c.patchJump(jumpNotTruthy)
+    if expr.Alternative != nil {
+        if err := c.compileBlock(expr.Alternative); err != nil {
+            return err
+        }
+    } else {
+        c.emit(code.Op_null)
+    }
+    c.patchJump(jump)
+    return nil
+}
+
+// compileFunctionLiteral compiles the body into a function of its own. Its
+// locals are its parameters followed by every name its body lets, all
+// given slots before the body is compiled, so a function written earlier
+// in the body can read a local bound after it, as mutual recursion needs.
+func (c *Compiler) compileFunctionLiteral(fn *ast.FunctionLiteral) error {
+    c.enterScope()
+    for _,param := range fn.Parameters {
+        c.symbols.Define(param.Value)
+    }
+    c.scope().params = len(fn.Parameters)
+    for _,name := range letNames(fn.Body, nil) {
+        c.symbols.Define(name)
+    }
+    if len(c.symbols.Names()) > math.MaxUint8 + 1 {
+        c.leaveScope()
+        return errorAt(fn, "too many local bindings")
+    }
+
+    if err := c.compileBlock(fn.Body); err != nil {
+        c.leaveScope()
+        return err
+    }
+    c.emit(code.Op_returnValue)
+    locals := c.symbols.Names()
+    body := c.leaveScope()
+
+    compiled := &object.CompiledFunction{
+        Instructions: body.instructions,
+        Operators: body.operators,
+        Locals: locals,
+        Refs: body.refs,
+        Parameters: fn.Parameters,
+        Body: fn.Body,
+    }
+    index,err := c.addConstant(compiled)
+    if err != nil {
+        return err
+    }
+    c.emit(code.Op_closure, index)
+    return nil
+}
+
+// letNames appends the names bound by the lets in node, in order. Lets
+// inside a function literal bind in a scope of their own and are left out.
+func letNames(node ast.Node, names []string) []string {
+    switch node := node.(type) {
+        case *ast.BlockStatement: {
+            for _,stmt := range node.Statements {
+                names = letNames(stmt, names)
+            }
+        }
+        case *ast.LetStatement: {
+            names = letNames(node.Value, names)
+            if ident,ok := node.Identifier.(*ast.Identifier); ok {
+                names = append(names, ident.Value)
+            }
+        }
+        case *ast.ReturnStatement: names = letNames(node.Value, names)
+        case *ast.ExpressionStatement: names = letNames(node.Value, names)
+        case *ast.PrefixExpression: names = letNames(node.Right, names)
+        case *ast.InfixExpression: names = letNames(node.Right, letNames(node.Left, names))
+        case *ast.IfExpression: {
+            names = letNames(node.Condition, names)
+            names = letNames(node.Consequence, names)
+            if node.Alternative != nil {
+                names = letNames(node.Alternative, names)
+            }
+        }
+        case *ast.CallExpression: {
+            names = letNames(node.Function, names)
+            for _,arg := range node.Arguments {
+                names = letNames(arg, names)
+            }
+        }
+        case *ast.ArrayLiteral: {
+            for _,elem := range node.Elements {
+                names = letNames(elem, names)
+            }
+        }
+        case *ast.HashLiteral: {
+            for _,pair := range node.Pairs {
+                names = letNames(pair.Value, letNames(pair.Key, names))
+            }
+        }
+        case *ast.IndexExpression: names = letNames(node.Index, letNames(node.Left, names))
+    }
+    return names
+}
+
+// compileExpressions compiles exprs left to right, leaving their values on
+// the stack in order.
+func (c *Compiler) compileExpressions(exprs []ast.Expression) error {
+    for _,e := range exprs {
+        if err := c.Compile(e); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+// }}}
+
+// scopes {{{
+func newScope() scope {
+    return scope{
+        instructions: code.Instructions{},
+        operators: map[int]token.Token{},
+        refIndex: map[string]int{},
+    }
+}
+
+func (c *Compiler) enterScope() {
+    c.scopes = append(c.scopes, newScope())
+    c.symbols = NewEnclosedSymbolTable(c.symbols)
+}
+
+func (c *Compiler) leaveScope() scope {
+    s := c.scopes[len(c.scopes)-1]
+    c.scopes = c.scopes[:len(c.scopes)-1]
+    c.symbols = c.symbols.outer
+    return s
+}
+
+func (c *Compiler) scope() *scope {
+    return &c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) instructions() code.Instructions {
+    return c.scopes[len(c.scopes)-1].instructions
+}
+// }}}
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+    if len(c.constants) > math.MaxUint16 {
+        return 0, fmt.Errorf("too many constants")
+    }
+    c.constants = append(c.constants, obj)
+    return len(c.constants)-1, nil
+}
+
+func (c *Compiler) emitConstant(obj object.Object) error {
+    index,err := c.addConstant(obj)
+    if err != nil {
+        return err
+    }
+    c.emit(code.Op_constant, index)
+    return nil
+}
+
+// emit appends an instruction to the current scope and returns its offset.
+// An operand too large for the instruction is kept in c.err.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+    pos := len(c.instructions())
+    c.check(op, operands...)
+    c.scopes[len(c.scopes)-1].instructions = append(c.instructions(), code.Make(op, operands...)...)
+    return pos
+}
+
+func (c *Compiler) check(op code.Opcode, operands ...int) {
+    if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+        c.err = err
+    }
+}
+
+// emitOperator emits an operator instruction and remembers the token it
+// came from, so the vm can point at it if the operation fails.
+func (c *Compiler) emitOperator(tok token.Token, op code.Opcode) int {
+    pos := c.emit(op)
+    c.scopes[len(c.scopes)-1].operators[pos] = tok
+    return pos
+}
+
+// patchJump points the jump at pos to the next instruction to be emitted.
+func (c *Compiler) patchJump(pos int) {
+    ins := c.instructions()
+    op := code.Opcode(ins[pos])
+    c.check(op, len(ins))
+    copy(ins[pos:], code.Make(op, len(ins)))
+}
@@ -0,0 +1,471 @@
+package compiler
+
+import (
+	"interpreter/code"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"reflect"
+	"testing"
+)
+
+type compilerTest struct {
+    input string
+    constants []any
+    instructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            "1 + 2;",
+            []any{ 1, 2 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_add),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "1; 2 * 3 / 4;",
+            []any{ 1, 2, 3, 4 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_pop),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_constant, 2),
+                code.Make(code.Op_mul),
+                code.Make(code.Op_constant, 3),
+                code.Make(code.Op_div),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "-1 - 2;",
+            []any{ 1, 2 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_minus),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_sub),
+                code.Make(code.Op_pop),
+            },
+        },
+    })
+}
+
+func TestBooleanExpressions(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            "true != !false;",
+            []any{},
+            []code.Instructions{
+                code.Make(code.Op_true),
+                code.Make(code.Op_false),
+                code.Make(code.Op_bang),
+                code.Make(code.Op_notEqual),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            // < keeps its operands in order, so they run left to right
+            "1 < 2 == 2 > 1;",
+            []any{ 1, 2, 2, 1 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_lessThan),
+                code.Make(code.Op_constant, 2),
+                code.Make(code.Op_constant, 3),
+                code.Make(code.Op_greaterThan),
+                code.Make(code.Op_equal),
+                code.Make(code.Op_pop),
+            },
+        },
+    })
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            "let one = 1; let two = one; two;",
+            []any{ 1 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_setGlobal, 0),
+                code.Make(code.Op_getGlobal, 0),
+                code.Make(code.Op_setGlobal, 1),
+                code.Make(code.Op_getGlobal, 1),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            // x is read before it is bound, and keeps its slot when it is
+            "x; let x = 1; let x = x;",
+            []any{ 1 },
+            []code.Instructions{
+                code.Make(code.Op_getGlobal, 0),
+                code.Make(code.Op_pop),
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_setGlobal, 0),
+                code.Make(code.Op_getGlobal, 0),
+                code.Make(code.Op_setGlobal, 0),
+            },
+        },
+        {
+            // builtins are found by the vm, after any global of the same name
+            "return len;",
+            []any{},
+            []code.Instructions{
+                code.Make(code.Op_getGlobal, 0),
+                code.Make(code.Op_returnValue),
+            },
+        },
+    })
+}
+
+func TestCompositeLiterals(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            `"mon" + "key";`,
+            []any{ "mon", "key" },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_add),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "[1, 2 + 3]; [];",
+            []any{ 1, 2, 3 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_constant, 2),
+                code.Make(code.Op_add),
+                code.Make(code.Op_array, 2),
+                code.Make(code.Op_pop),
+                code.Make(code.Op_array, 0),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            `{"a": 1, 2: true};`,
+            []any{ "a", 1, 2 },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_constant, 2),
+                code.Make(code.Op_true),
+                code.Make(code.Op_hash, 4),
+                code.Make(code.Op_pop),
+            },
+        },
+    })
+}
+
+func TestConditionals(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            "if (true) { 10 }; 3333;",
+            []any{ 10, 3333 },
+            []code.Instructions{
+                code.Make(code.Op_true),
+                code.Make(code.Op_jumpNotTruthy, 10),
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_jump, 11),
+                code.Make(code.Op_null),
+                code.Make(code.Op_pop),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            // a let ending a block leaves its value behind
+            "if (true) { let a = 1; } else {};",
+            []any{ 1 },
+            []code.Instructions{
+                code.Make(code.Op_true),
+                code.Make(code.Op_jumpNotTruthy, 16),
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_setGlobal, 0),
+                code.Make(code.Op_getGlobal, 0),
+                code.Make(code.Op_jump, 17),
+                code.Make(code.Op_null),
+                code.Make(code.Op_pop),
+            },
+        },
+    })
+}
+
+func TestFunctions(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            "fn(a, b) { let c = a; c + b }(1, 2);",
+            []any{
+                []code.Instructions{
+                    code.Make(code.Op_getLocal, 0),
+                    code.Make(code.Op_setLocal, 2),
+                    code.Make(code.Op_getName, 0),
+                    code.Make(code.Op_getLocal, 1),
+                    code.Make(code.Op_add),
+                    code.Make(code.Op_returnValue),
+                },
+                1,
+                2,
+            },
+            []code.Instructions{
+                code.Make(code.Op_closure, 0),
+                code.Make(code.Op_constant, 1),
+                code.Make(code.Op_constant, 2),
+                code.Make(code.Op_call, 2),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "let g = 1; fn() { g };",
+            []any{
+                1,
+                []code.Instructions{
+                    code.Make(code.Op_getGlobal, 0),
+                    code.Make(code.Op_returnValue),
+                },
+            },
+            []code.Instructions{
+                code.Make(code.Op_constant, 0),
+                code.Make(code.Op_setGlobal, 0),
+                code.Make(code.Op_closure, 1),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "fn() {};",
+            []any{
+                []code.Instructions{
+                    code.Make(code.Op_null),
+                    code.Make(code.Op_returnValue),
+                },
+            },
+            []code.Instructions{
+                code.Make(code.Op_closure, 0),
+                code.Make(code.Op_pop),
+            },
+        },
+    })
+}
+
+func TestSymbolTable(t *testing.T) {
+    table := NewSymbolTable()
+    a := table.Define("a")
+    b := table.Define("b")
+    again := table.Define("a")
+
+    expected := []Symbol{
+        { Name: "a", Scope: Scope_global, Index: 0 },
+        { Name: "b", Scope: Scope_global, Index: 1 },
+        { Name: "a", Scope: Scope_global, Index: 0 },
+    }
+    for i,sym := range []Symbol{ a, b, again } {
+        if sym != expected[i] {
+            t.Fatalf("Expected:%+v got:%+v", expected[i], sym)
+        }
+    }
+    if sym,ok := table.Resolve("b"); !ok || sym != expected[1] {
+        t.Fatalf("Expected b to resolve to:%+v got:%+v", expected[1], sym)
+    }
+    if _,ok := table.Resolve("c"); ok {
+        t.Fatalf("Expected c not to resolve")
+    }
+
+    outer := NewEnclosedSymbolTable(table)
+    outer.Define("x")
+    c := outer.Define("c")
+    if c != (Symbol{ Name: "c", Scope: Scope_local, Index: 1 }) {
+        t.Fatalf("Expected c to be local 1, got:%+v", c)
+    }
+    if _,ok := outer.Resolve("a"); ok {
+        t.Fatalf("Expected a not to resolve in a function scope")
+    }
+
+    inner := NewEnclosedSymbolTable(outer)
+    inner.Define("c")
+    tests := []struct {
+        name string
+        expected []object.Slot
+    } {
+        { "c", []object.Slot{ { Depth: 0, Index: 0 }, { Depth: 1, Index: 1 } } },
+        { "x", []object.Slot{ { Depth: 1, Index: 0 } } },
+        { "a", nil },
+    }
+    for _,test := range tests {
+        slots := inner.Locate(test.name)
+        if !reflect.DeepEqual(slots, test.expected) {
+            t.Fatalf("Expected %s to be in:%+v got:%+v", test.name, test.expected, slots)
+        }
+    }
+}
+
+func TestClosures(t *testing.T) {
+    runCompilerTests(t, []compilerTest{
+        {
+            "fn(a) { fn(b) { a + b } };",
+            []any{
+                []code.Instructions{
+                    code.Make(code.Op_getName, 0),
+                    code.Make(code.Op_getLocal, 0),
+                    code.Make(code.Op_add),
+                    code.Make(code.Op_returnValue),
+                },
+                []code.Instructions{
+                    code.Make(code.Op_closure, 0),
+                    code.Make(code.Op_returnValue),
+                },
+            },
+            []code.Instructions{
+                code.Make(code.Op_closure, 1),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "fn(a) { fn(b) { fn(c) { a + b + c } } };",
+            []any{
+                []code.Instructions{
+                    code.Make(code.Op_getName, 0),
+                    code.Make(code.Op_getName, 1),
+                    code.Make(code.Op_add),
+                    code.Make(code.Op_getLocal, 0),
+                    code.Make(code.Op_add),
+                    code.Make(code.Op_returnValue),
+                },
+                []code.Instructions{
+                    code.Make(code.Op_closure, 0),
+                    code.Make(code.Op_returnValue),
+                },
+                []code.Instructions{
+                    code.Make(code.Op_closure, 1),
+                    code.Make(code.Op_returnValue),
+                },
+            },
+            []code.Instructions{
+                code.Make(code.Op_closure, 2),
+                code.Make(code.Op_pop),
+            },
+        },
+        {
+            "fn() { let f = fn() { f() }; f };",
+            []any{
+                []code.Instructions{
+                    code.Make(code.Op_getName, 0),
+                    code.Make(code.Op_call, 0),
+                    code.Make(code.Op_returnValue),
+                },
+                []code.Instructions{
+                    code.Make(code.Op_closure, 0),
+                    code.Make(code.Op_setLocal, 0),
+                    code.Make(code.Op_getName, 0),
+                    code.Make(code.Op_returnValue),
+                },
+            },
+            []code.Instructions{
+                code.Make(code.Op_closure, 1),
+                code.Make(code.Op_pop),
+            },
+        },
+    })
+}
+
+// TestRefs checks where a function looks for the names it reads: every
+// enclosing function that lets them, even after the read, then the global.
+func TestRefs(t *testing.T) {
+    input := "let g = 1; fn(n) { let a = fn() { b(n) + g }; if (n) { let b = fn(x) { x }; }; a };"
+    l := lexer.New([]byte(input))
+    p := parser.New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        t.Fatalf("could not parse:%s (%s)", input, errs[0])
+    }
+    c := New()
+    if err := c.Compile(program); err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+    bytecode := c.Bytecode()
+
+    inner := bytecode.Constants[1].(*object.CompiledFunction)
+    expected := []object.Ref{
+        { Name: "b", Slots: []object.Slot{ { Depth: 1, Index: 2 } }, Global: 1 },
+        { Name: "n", Slots: []object.Slot{ { Depth: 1, Index: 0 } }, Global: 2 },
+    }
+    if !reflect.DeepEqual(inner.Refs, expected) {
+        t.Fatalf("Expected refs:%+v got:%+v", expected, inner.Refs)
+    }
+    outer := bytecode.Constants[3].(*object.CompiledFunction)
+    if !reflect.DeepEqual(outer.Locals, []string{ "n", "a", "b" }) {
+        t.Fatalf("Expected locals:[n a b] got:%v", outer.Locals)
+    }
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTest) {
+    t.Helper()
+    for _,test := range tests {
+        l := lexer.New([]byte(test.input))
+        p := parser.New(&l)
+        program,errs := p.ParseProgram()
+        if len(errs) > 0 {
+            t.Fatalf("could not parse:%s (%s)", test.input, errs[0])
+        }
+
+        c := New()
+        if err := c.Compile(program); err != nil {
+            t.Fatalf("compiler error: %s", err)
+        }
+        bytecode := c.Bytecode()
+
+        expected := code.Instructions{}
+        for _,ins := range test.instructions {
+            expected = append(expected, ins...)
+        }
+        if bytecode.Instructions.String() != expected.String() {
+            t.Fatalf("%s: wrong instructions\nExpected:\n%sgot:\n%s", test.input, expected, bytecode.Instructions)
+        }
+        testConstants(t, test.input, test.constants, bytecode.Constants)
+    }
+}
+
+// testConstants compares the pool against Go values.
+func testConstants(t *testing.T, input string, expected []any, actual []object.Object) {
+    t.Helper()
+    if len(expected) != len(actual) {
+        t.Fatalf("%s: Expected %d constants, got:%d", input, len(expected), len(actual))
+    }
+    for i,want := range expected {
+        switch want := want.(type) {
+            case int: {
+                obj,ok := actual[i].(*object.Integer)
+                if !ok || obj.Value != int64(want) {
+                    t.Fatalf("%s: Expected constant %d to be %d, got:%s", input, i, want, actual[i].Inspect())
+                }
+            }
+            case []code.Instructions: {
+                fn,ok := actual[i].(*object.CompiledFunction)
+                if !ok {
+                    t.Fatalf("%s: Expected constant %d to be a function, got:%s", input, i, actual[i].Inspect())
+                }
+                ins := code.Instructions{}
+                for _,in := range want {
+                    ins = append(ins, in...)
+                }
+                if fn.Instructions.String() != ins.String() {
+                    t.Fatalf("%s: wrong instructions for constant %d\nExpected:\n%sgot:\n%s", input, i, ins, fn.Instructions)
+                }
+            }
+            case string: {
+                obj,ok := actual[i].(*object.String)
+                if !ok || obj.Value != want {
+                    t.Fatalf("%s: Expected constant %d to be %q, got:%s", input, i, want, actual[i].Inspect())
+                }
+            }
+        }
+    }
+}
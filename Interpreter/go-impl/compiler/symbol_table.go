@@ -0,0 +1,89 @@
+package compiler
+
+import "interpreter/object"
+
+type SymbolScope string
+
+const (
+    Scope_global SymbolScope = "GLOBAL"
+    Scope_local SymbolScope = "LOCAL"
+)
+
+// Symbol is a name the compiler has given a storage slot.
+type Symbol struct {
+    Name string
+    Scope SymbolScope
+    Index int
+}
+
+// SymbolTable holds the names of one scope. Every function body gets a
+// table of its own, enclosing the one it was written in. Blocks don't, so
+// a let inside an if binds in the function around it, like it does in the
+// evaluator.
+type SymbolTable struct {
+    outer *SymbolTable
+    store map[string]Symbol
+    names []string
+}
+
+func NewSymbolTable() *SymbolTable {
+    return &SymbolTable{
+        store: map[string]Symbol{},
+    }
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+    s := NewSymbolTable()
+    s.outer = outer
+    return s
+}
+
+// Define gives name the next free slot. Defining a name twice keeps its
+// slot, so a second let overwrites the first like it does in the
+// evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+    if sym,ok := s.store[name]; ok {
+        return sym
+    }
+    scope := Scope_global
+    if s.outer != nil {
+        scope = Scope_local
+    }
+    sym := Symbol{ Name: name, Scope: scope, Index: len(s.names) }
+    s.store[name] = sym
+    s.names = append(s.names, name)
+    return sym
+}
+
+// Resolve finds name in this scope alone.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+    sym,ok := s.store[name]
+    return sym, ok
+}
+
+// Locate finds every function scope, from this one outwards, that defines
+// name. The global scope is left out: a name always has a global slot to
+// fall back to.
+func (s *SymbolTable) Locate(name string) []object.Slot {
+    var slots []object.Slot
+    depth := 0
+    for t := s; t.outer != nil; t = t.outer {
+        if sym,ok := t.store[name]; ok {
+            slots = append(slots, object.Slot{ Depth: depth, Index: sym.Index })
+        }
+        depth++
+    }
+    return slots
+}
+
+// Names lists the names defined in this scope, indexed by slot.
+func (s *SymbolTable) Names() []string {
+    return s.names
+}
+
+func (s *SymbolTable) global() *SymbolTable {
+    if s.outer == nil {
+        return s
+    }
+    return s.outer.global()
+}
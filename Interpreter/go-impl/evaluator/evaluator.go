@@ -0,0 +1,249 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+    switch node := node.(type) {
+        case *ast.Program: return evalProgram(node, env)
+
+        // statements
+        case *ast.LetStatement: return evalLetStatement(node, env)
+        case *ast.ReturnStatement: return evalReturnStatement(node, env)
+        case *ast.ExpressionStatement: return Eval(node.Value, env)
+        case *ast.BlockStatement: return evalBlockStatement(node, env)
+
+        // expressions
+        case *ast.IntLiteral: return &object.Integer{ Value: node.Value }
+        case *ast.BoolLiteral: return object.NewBoolean(node.Value)
+        case *ast.StringLiteral: return &object.String{ Value: node.Value }
+        case *ast.Identifier: return evalIdentifier(node, env)
+        case *ast.PrefixExpression: return evalPrefixExpression(node, env)
+        case *ast.InfixExpression: return evalInfixExpression(node, env)
+        case *ast.FunctionLiteral: return &object.Function{ Parameters: node.Parameters, Body: node.Body, Env: env }
+        case *ast.IfExpression: return evalIfExpression(node, env)
+        case *ast.CallExpression: return evalCallExpression(node, env)
+        case *ast.ArrayLiteral: return evalArrayLiteral(node, env)
+        case *ast.HashLiteral: return evalHashLiteral(node, env)
+        case *ast.IndexExpression: return evalIndexExpression(node, env)
+    }
+    return newError("cannot evaluate node: %s", node.ToString())
+}
+
+// evalProgram returns the value of the last statement, or of the first
+// return statement reached.
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+    var result object.Object = object.NULL
+    for _,stmt := range program.Statements {
+        result = Eval(stmt, env)
+        switch r := result.(type) {
+            case *object.ReturnValue: return r.Value
+            case *object.Error: return r
+        }
+    }
+    return result
+}
+
+// eval statements {{{
+func evalLetStatement(stmt *ast.LetStatement, env *object.Environment) object.Object {
+    ident,ok := stmt.Identifier.(*ast.Identifier)
+    if !ok {
+        return newError("invalid let target: %s", stmt.Identifier.ToString())
+    }
+    val := Eval(stmt.Value, env)
+    if isError(val) {
+        return val
+    }
+    env.Set(ident.Value, val)
+    return val
+}
+
+func evalReturnStatement(stmt *ast.ReturnStatement, env *object.Environment) object.Object {
+    val := Eval(stmt.Value, env)
+    if isError(val) {
+        return val
+    }
+    return &object.ReturnValue{ Value: val }
+}
+
+// evalBlockStatement is like evalProgram but leaves return values
+// wrapped, so a return inside a nested block stops every enclosing block too.
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+    var result object.Object = object.NULL
+    for _,stmt := range block.Statements {
+        result = Eval(stmt, env)
+        if result.Type() == object.Obj_return || result.Type() == object.Obj_error {
+            return result
+        }
+    }
+    return result
+}
+// }}}
+
+// eval expressions {{{
+func evalIdentifier(ident *ast.Identifier, env *object.Environment) object.Object {
+    if val,ok := env.Get(ident.Value); ok {
+        return val
+    }
+    if builtin,ok := object.LookupBuiltin(ident.Value); ok {
+        return builtin
+    }
+    return env.Resolve(ident)
+}
+
+func evalPrefixExpression(expr *ast.PrefixExpression, env *object.Environment) object.Object {
+    right := Eval(expr.Right, env)
+    if isError(right) {
+        return right
+    }
+    return object.Locate(object.ApplyPrefix(expr.Opperator, right), expr.Token)
+}
+
+func evalInfixExpression(expr *ast.InfixExpression, env *object.Environment) object.Object {
+    left := Eval(expr.Left, env)
+    if isError(left) {
+        return left
+    }
+    right := Eval(expr.Right, env)
+    if isError(right) {
+        return right
+    }
+    return object.Locate(object.ApplyInfix(expr.Opperator, left, right), expr.Token)
+}
+
+func evalIfExpression(expr *ast.IfExpression, env *object.Environment) object.Object {
+    cond := Eval(expr.Condition, env)
+    if isError(cond) {
+        return cond
+    }
+
+    if object.IsTruthy(cond) {
+        return Eval(expr.Consequence, env)
+    } else if expr.Alternative != nil {
+        return Eval(expr.Alternative, env)
+    }
+    return object.NULL
+}
+
+func evalCallExpression(expr *ast.CallExpression, env *object.Environment) object.Object {
+    function := Eval(expr.Function, env)
+    if isError(function) {
+        return function
+    }
+
+    args,err := evalExpressions(expr.Arguments, env)
+    if err != nil {
+        return err
+    }
+    return ApplyFunction(function, args)
+}
+
+// ApplyFunction calls a script function or builtin with already evaluated
+// arguments. It lets host code call back into functions a script returned.
+// A builtin that returns nil gives null.
+func ApplyFunction(function object.Object, args []object.Object) object.Object {
+    if builtin,ok := function.(*object.Builtin); ok {
+        if res := builtin.Fn(args...); res != nil {
+            return res
+        }
+        return object.NULL
+    }
+    fn,ok := function.(*object.Function)
+    if !ok {
+        return newError("not a function: %s", function.Type())
+    }
+    if len(args) != len(fn.Parameters) {
+        return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+    }
+    calls := fn.Env.Calls()
+    if calls.Ctx != nil {
+        if err := calls.Ctx.Err(); err != nil {
+            return newError("%s", err)
+        }
+    }
+    if calls.Depth >= object.MaxCallDepth {
+        return newError("stack overflow")
+    }
+    calls.Depth++
+    defer func() { calls.Depth-- }()
+
+    env := object.NewEnclosedEnvironment(fn.Env)
+    for i,param := range fn.Parameters {
+        env.Set(param.Value, args[i])
+    }
+
+    result := Eval(fn.Body, env)
+    if ret,ok := result.(*object.ReturnValue); ok {
+        return ret.Value
+    }
+    return result
+}
+
+
+func evalArrayLiteral(expr *ast.ArrayLiteral, env *object.Environment) object.Object {
+    elems,err := evalExpressions(expr.Elements, env)
+    if err != nil {
+        return err
+    }
+    return &object.Array{ Elements: elems }
+}
+
+func evalIndexExpression(expr *ast.IndexExpression, env *object.Environment) object.Object {
+    left := Eval(expr.Left, env)
+    if isError(left) {
+        return left
+    }
+    index := Eval(expr.Index, env)
+    if isError(index) {
+        return index
+    }
+    return object.ApplyIndex(left, index)
+}
+
+// evalHashLiteral evaluates every key and value, left to right, before it
+// checks that the keys can be hashed, the same as the vm does.
+func evalHashLiteral(expr *ast.HashLiteral, env *object.Environment) object.Object {
+    exprs := make([]ast.Expression, 0, 2*len(expr.Pairs))
+    for _,p := range expr.Pairs {
+        exprs = append(exprs, p.Key, p.Value)
+    }
+    vals,err := evalExpressions(exprs, env)
+    if err != nil {
+        return err
+    }
+
+    pairs := make(map[object.HashKey]object.HashPair, len(expr.Pairs))
+    for i := 0; i < len(vals); i += 2 {
+        key := vals[i]
+        hashable,ok := key.(object.Hashable)
+        if !ok {
+            return newError("unusable as hash key: %s", key.Type())
+        }
+        pairs[hashable.HashKey()] = object.HashPair{ Key: key, Value: vals[i+1] }
+    }
+    return &object.Hash{ Pairs: pairs }
+}
+
+// evalExpressions evaluates exprs left to right, stopping at the first error.
+func evalExpressions(exprs []ast.Expression, env *object.Environment) ([]object.Object, object.Object) {
+    res := make([]object.Object, 0, len(exprs))
+    for _,e := range exprs {
+        val := Eval(e, env)
+        if isError(val) {
+            return nil, val
+        }
+        res = append(res, val)
+    }
+    return res, nil
+}
+// }}}
+
+func isError(obj object.Object) bool {
+    return obj != nil && obj.Type() == object.Obj_error
+}
+
+func newError(format string, a ...any) *object.Error {
+    return object.NewError(format, a...)
+}
@@ -0,0 +1,444 @@
+package evaluator
+
+import (
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+func testEval(input string) object.Object {
+    return testEvalIn(input, object.NewEnvironment())
+}
+
+func testEvalIn(input string, env *object.Environment) object.Object {
+    l := lexer.New([]byte(input))
+    p := parser.New(&l)
+    program,_ := p.ParseProgram()
+    return Eval(program, env)
+}
+
+func TestIntegerExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    } {
+        { "5;", 5 },
+        { "-10;", -10 },
+        { "5 + 5 + 5 + 5 - 10;", 10 },
+        { "2 * 2 * 2 * 2 * 2;", 32 },
+        { "-50 + 100 + -50;", 0 },
+        { "20 + 2 * -10;", 0 },
+        { "50 / 2 * 2 + 10;", 60 },
+        { "3 * (3 * 3) + 10;", 37 },
+        { "(5 + 10 * 2 + 15 / 3) * 2 + -10;", 50 },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        i,ok := res.(*object.Integer)
+        if !ok {
+            t.Fatalf("Expected:Integer got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if i.Value != test.expected {
+            t.Fatalf("Expected:%d got:%d", test.expected, i.Value)
+        }
+    }
+}
+
+func TestBooleanExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected bool
+    } {
+        { "true;", true },
+        { "false;", false },
+        { "!true;", false },
+        { "!!5;", true },
+        { "1 < 2;", true },
+        { "1 > 2;", false },
+        { "1 == 1;", true },
+        { "1 != 1;", false },
+        { "true == true;", true },
+        { "true != false;", true },
+        { "(1 < 2) == true;", true },
+        { "(1 > 2) == true;", false },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        b,ok := res.(*object.Boolean)
+        if !ok {
+            t.Fatalf("Expected:Boolean got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if b.Value != test.expected {
+            t.Fatalf("Expected:%t got:%t", test.expected, b.Value)
+        }
+    }
+}
+
+func TestLetAndReturnStatements(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    } {
+        { "let a = 5; a;", 5 },
+        { "let a = 5 * 5; a;", 25 },
+        { "let a = 5; let b = a; let c = a + b + 5; c;", 15 },
+        { "return 10; 9;", 10 },
+        { "9; return 2 * 5; 9;", 10 },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        i,ok := res.(*object.Integer)
+        if !ok {
+            t.Fatalf("Expected:Integer got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if i.Value != test.expected {
+            t.Fatalf("Expected:%d got:%d", test.expected, i.Value)
+        }
+    }
+}
+
+func TestErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { "5 + true;", "type mismatch: INTEGER + BOOLEAN" },
+        { "5 + true; 5;", "type mismatch: INTEGER + BOOLEAN" },
+        { "-true;", "unknown operator: -BOOLEAN" },
+        { "true + false;", "unknown operator: BOOLEAN + BOOLEAN" },
+        { "foobar;", "identifier not found: foobar" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        e,ok := res.(*object.Error)
+        if !ok {
+            t.Fatalf("Expected:Error got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if e.Message != test.expected {
+            t.Fatalf("Expected:'%s' got:'%s'", test.expected, e.Message)
+        }
+    }
+}
+
+func TestOperatorErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+        operator string
+    } {
+        { "10 / 0;", "1:4: division by zero: 10 / 0", "/" },
+        { "let a = 1;\n5 + (a - 1) / (a - 1);", "2:13: division by zero: 0 / 0", "/" },
+        { "9223372036854775807 + 1;", "1:21: integer overflow: 9223372036854775807 + 1", "+" },
+        { "-9223372036854775807 - 2;", "1:22: integer overflow: -9223372036854775807 - 2", "-" },
+        { "3037000500 * 3037000500;", "1:12: integer overflow: 3037000500 * 3037000500", "*" },
+        { "let min = -9223372036854775807 - 1; min / -1;", "1:41: integer overflow: -9223372036854775808 / -1", "/" },
+        { "let min = -9223372036854775807 - 1; -min;", "1:37: integer overflow: -(-9223372036854775808)", "-" },
+        { "true + 1;", "1:6: type mismatch: BOOLEAN + INTEGER", "+" },
+        { "if (1 < \"a\") { 1 };", "1:7: type mismatch: INTEGER < STRING", "<" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        e,ok := res.(*object.Error)
+        if !ok {
+            t.Fatalf("%s: Expected:Error got:%s (%s)", test.input, res.Type(), res.Inspect())
+        }
+        if e.Error() != test.expected {
+            t.Fatalf("Expected:'%s' got:'%s'", test.expected, e.Error())
+        }
+        if e.Token.Literal != test.operator {
+            t.Fatalf("%s: Expected operator:%s got:%s", test.input, test.operator, e.Token.Literal)
+        }
+    }
+}
+
+func TestSingletonObjects(t *testing.T) {
+    tests := []struct {
+        input string
+        expected object.Object
+    } {
+        { "true;", object.TRUE },
+        { "1 < 2;", object.TRUE },
+        { "!true;", object.FALSE },
+        { "true != true;", object.FALSE },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res != test.expected {
+            t.Fatalf("Expected:%s got:%s (not shared)", test.expected.Inspect(), res.Inspect())
+        }
+    }
+}
+
+func TestFunctionApplication(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    } {
+        { "let identity = fn(x) { x; }; identity(5);", 5 },
+        { "let identity = fn(x) { return x; }; identity(5);", 5 },
+        { "let double = fn(x) { x * 2; }; double(5);", 10 },
+        { "let add = fn(a, b) { a + b; }; add(1, 2);", 3 },
+        { "let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20 },
+        { "fn(x) { x; }(5);", 5 },
+        { "let f = fn() { return 1; 2; }; f() + 10;", 11 },
+        { "let x = 10; let f = fn(x) { x; }; f(1) + x;", 11 },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        i,ok := res.(*object.Integer)
+        if !ok {
+            t.Fatalf("Expected:Integer got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if i.Value != test.expected {
+            t.Fatalf("Expected:%d got:%d", test.expected, i.Value)
+        }
+    }
+}
+
+func TestClosures(t *testing.T) {
+    tests := []struct {
+        input string
+        expected int64
+    } {
+        { "let adder = fn(x) { fn(y) { x + y } }; let add2 = adder(2); add2(3);", 5 },
+        { "let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3);", 6 },
+        { "let f = fn() { let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(5) }; f();", 5 },
+        { "let twice = fn(f) { fn(x) { f(f(x)) } }; twice(fn(x) { x * 3 })(2);", 18 },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        i,ok := res.(*object.Integer)
+        if !ok {
+            t.Fatalf("Expected:Integer got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if i.Value != test.expected {
+            t.Fatalf("Expected:%d got:%d", test.expected, i.Value)
+        }
+    }
+}
+
+func TestCallDepth(t *testing.T) {
+    env := object.NewEnvironment()
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { "let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(1000);", "1000" },
+        { "count(5000);", "ERROR: stack overflow" },
+        // the depth is unwound after a call fails, so later calls still work
+        { "count(1000);", "1000" },
+    }
+
+    for _,test := range tests {
+        res := testEvalIn(test.input, env)
+        if res.Inspect() != test.expected {
+            t.Fatalf("%s: Expected:%s got:%s", test.input, test.expected, res.Inspect())
+        }
+    }
+    if env.Calls().Depth != 0 {
+        t.Fatalf("Expected depth:0 got:%d", env.Calls().Depth)
+    }
+}
+
+func TestFunctionErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { "let a = 1; a(2);", "not a function: INTEGER" },
+        { "let f = fn(a, b) { a; }; f(1);", "wrong number of arguments: want=2, got=1" },
+        { "let f = fn(n) { f(n + 1) }; f(0);", "stack overflow" },
+        { "let f = fn(n) { 1 + f(n) }; f(0);", "stack overflow" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        e,ok := res.(*object.Error)
+        if !ok {
+            t.Fatalf("Expected:Error got:%s (%s)", res.Type(), res.Inspect())
+        }
+        if e.Message != test.expected {
+            t.Fatalf("Expected:'%s' got:'%s'", test.expected, e.Message)
+        }
+    }
+}
+
+func TestIfElseExpressions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected object.Object
+    } {
+        { "if (true) { 10 }", &object.Integer{ Value: 10 } },
+        { "if (false) { 10 }", object.NULL },
+        { "if (1) { 10 }", &object.Integer{ Value: 10 } },
+        { "if (1 < 2) { 10 } else { 20 }", &object.Integer{ Value: 10 } },
+        { "if (1 > 2) { 10 } else { 20 }", &object.Integer{ Value: 20 } },
+        { "let a = if (1 > 2) { 10 } else { 20 }; a * 2;", &object.Integer{ Value: 40 } },
+        { "if (10 > 1) { if (10 > 1) { return 10; } return 1; }", &object.Integer{ Value: 10 } },
+        { "let f = fn(x) { if (x > 5) { return 1; } 0; }; f(10) + f(2);", &object.Integer{ Value: 1 } },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res.Type() != test.expected.Type() || res.Inspect() != test.expected.Inspect() {
+            t.Fatalf("Expected:%s got:%s", test.expected.Inspect(), res.Inspect())
+        }
+    }
+}
+
+func TestStrings(t *testing.T) {
+    tests := []struct {
+        input string
+        expected object.Object
+    } {
+        { `"Hello World!";`, &object.String{ Value: "Hello World!" } },
+        { `"Hello" + " " + "World!";`, &object.String{ Value: "Hello World!" } },
+        { `let greet = fn(name) { "Hi, " + name + "\n" }; greet("Bob");`, &object.String{ Value: "Hi, Bob\n" } },
+        { `"a" == "a";`, object.TRUE },
+        { `"a" != "a";`, object.FALSE },
+        { `"a" - "b";`, &object.Error{ Message: "unknown operator: STRING - STRING" } },
+        { `"a" + 1;`, &object.Error{ Message: "type mismatch: STRING + INTEGER" } },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res.Type() != test.expected.Type() || res.Inspect() != test.expected.Inspect() {
+            t.Fatalf("Expected:%s got:%s", test.expected.Inspect(), res.Inspect())
+        }
+    }
+}
+
+func TestArrays(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { "[1, 2 * 2, 3 + 3];", "[1, 4, 6]" },
+        { "[1, 2, 3][0];", "1" },
+        { "let i = 0; [1][i];", "1" },
+        { "let a = [1, 2, 3]; a[0] + a[1] + a[2];", "6" },
+        { "[1, 2, 3][3];", "null" },
+        { "[1, 2, 3][-1];", "null" },
+        { "1[0];", "ERROR: index operator not supported: INTEGER[INTEGER]" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res.Inspect() != test.expected {
+            t.Fatalf("Expected:%s got:%s", test.expected, res.Inspect())
+        }
+    }
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { `len("");`, "0" },
+        { `len("four");`, "4" },
+        { `len("naïve");`, "5" },
+        { `len("\u{1F600}!");`, "2" },
+        { `len([1, 2, 3]);`, "3" },
+        { `len(1);`, "ERROR: argument to `len` must be STRING or ARRAY, got INTEGER" },
+        { `len("one", "two");`, "ERROR: wrong number of arguments: want=1, got=2" },
+        { `first([1, 2, 3]);`, "1" },
+        { `first([]);`, "null" },
+        { `last([1, 2, 3]);`, "3" },
+        { `rest([1, 2, 3]);`, "[2, 3]" },
+        { `rest([]);`, "null" },
+        { `let a = [1]; let b = push(a, 2); a;`, "[1]" },
+        { `push([1], 2);`, "[1, 2]" },
+        { `push(1, 1);`, "ERROR: argument to `push` must be ARRAY, got INTEGER" },
+        { `let len = fn(x) { 42 }; len([]);`, "42" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res.Inspect() != test.expected {
+            t.Fatalf("Expected:%s got:%s", test.expected, res.Inspect())
+        }
+    }
+}
+
+func TestHashes(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { `let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6};`, "{4: 4, false: 6, one: 1, three: 3, true: 5, two: 2}" },
+        { `{"foo": 5}["foo"];`, "5" },
+        { `{"foo": 5}["bar"];`, "null" },
+        { `let key = "foo"; {"foo": 5}[key];`, "5" },
+        { `{}["foo"];`, "null" },
+        { `{5: 5}[5];`, "5" },
+        { `{true: 5}[true];`, "5" },
+        { `{1: "int", true: "bool"}[1];`, "int" },
+        { `{"name": "Monkey"}[fn(x) { x }];`, "ERROR: unusable as hash key: FUNCTION" },
+        { `{[1]: 2};`, "ERROR: unusable as hash key: ARRAY" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res.Inspect() != test.expected {
+            t.Fatalf("Expected:%s got:%s", test.expected, res.Inspect())
+        }
+    }
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+    object.RegisterBuiltin("testJoin", func(args ...object.Object) object.Object {
+        if err := object.CheckArgCount(args, 2); err != nil {
+            return err
+        }
+        for i := range args {
+            if err := object.CheckArgType("testJoin", args, i, object.Obj_string); err != nil {
+                return err
+            }
+        }
+        return &object.String{ Value: args[0].Inspect() + "-" + args[1].Inspect() }
+    })
+    object.RegisterBuiltin("testNothing", func(args ...object.Object) object.Object { return nil })
+    // a host may build its own booleans rather than use TRUE and FALSE
+    object.RegisterBuiltin("testOff", func(args ...object.Object) object.Object {
+        return &object.Boolean{ Value: false }
+    })
+    t.Cleanup(func() {
+        for _,name := range []string{ "testJoin", "testNothing", "testOff" } {
+            object.UnregisterBuiltin(name)
+        }
+    })
+
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { `testJoin("a", "b");`, "a-b" },
+        { `let f = testJoin; f("x", "y");`, "x-y" },
+        { `testJoin("a");`, "ERROR: wrong number of arguments: want=2, got=1" },
+        { `testJoin("a", 1);`, "ERROR: argument to `testJoin` must be STRING, got INTEGER" },
+        { `let testJoin = fn(a, b) { a }; testJoin("a", "b");`, "a" },
+        { `testNothing();`, "null" },
+        { `let f = fn() { testNothing(); 1 }; f();`, "1" },
+        { `testOff() == false;`, "true" },
+        { `testOff() != false;`, "false" },
+        { `if (testOff()) { "yes" } else { "no" };`, "no" },
+        { `!testOff();`, "true" },
+    }
+
+    for _,test := range tests {
+        res := testEval(test.input)
+        if res.Inspect() != test.expected {
+            t.Fatalf("Expected:%s got:%s", test.expected, res.Inspect())
+        }
+    }
+}
@@ -0,0 +1,31 @@
+package lexer
+
+import (
+	"fmt"
+	"interpreter/token"
+)
+
+// Error describes a malformed token: an unterminated string or comment, a
+// bad escape, or an invalid numeric literal. The token itself comes out of
+// NextToken as token.Illegal, holding the offending source text.
+type Error struct {
+    Message string
+    Pos token.Position
+}
+
+func (e Error) Error() string {
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Errors returns the diagnostics for every token lexed so far, in source
+// order.
+func (l *Lexer) Errors() []Error {
+    return l.errors
+}
+
+func (l *Lexer) addError(pos token.Position, format string, args ...any) {
+    l.errors = append(l.errors, Error {
+        Message: fmt.Sprintf(format, args...),
+        Pos: pos,
+    })
+}
@@ -2,74 +2,240 @@ package lexer
 
 import (
 	"interpreter/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Lexer walks UTF-8 source one rune at a time. Offsets in positions count
+// bytes, while columns count runes.
 type Lexer struct {
     src []byte
-    ch byte
+    file string
+    ch rune
     cur_pos uint32
     next_pos uint32
+    line uint32
+    col uint32
+    keepComments bool
+    errors []Error
+    // offsets of the tokens that follow a blank line, when comments are kept
+    blankLines map[uint32]bool
 }
 
 func New(src []byte) Lexer {
+    return NewFile("", src)
+}
+
+// NewFile is like New, but the positions of every token also carry the
+// name of the file the source was read from.
+func NewFile(file string, src []byte) Lexer {
     l := Lexer{
         src: src,
+        file: file,
         ch: 0,
         cur_pos: 0,
         next_pos: 0,
+        line: 1,
+        col: 0,
     }
     l.Incr()
     return l
 }
 
+// KeepComments makes the lexer return comments as token.Comment tokens
+// instead of skipping them, for tools that need to preserve them.
+func (l *Lexer) KeepComments(keep bool) {
+    l.keepComments = keep
+}
+
+// BlankLines reports the offsets of the tokens and comments that have a
+// blank line before them. Like comments, they are only kept on request.
+func (l *Lexer) BlankLines() map[uint32]bool {
+    return l.blankLines
+}
+
 func (l *Lexer) Incr() {
+    if l.ch == '\n' {
+        l.line++
+        l.col = 1
+    } else {
+        l.col++
+    }
     l.cur_pos = l.next_pos
-    l.next_pos++
     if int(l.cur_pos) >= len(l.src){
         l.ch = 0
+        l.next_pos = l.cur_pos + 1
         return
     }
-    l.ch = l.src[l.cur_pos]
+    r,width := utf8.DecodeRune(l.src[l.cur_pos:])
+    l.ch = r
+    l.next_pos = l.cur_pos + uint32(width)
 }
-func (l *Lexer) decr() {
-    l.next_pos = l.cur_pos
-    l.cur_pos--
-    l.ch = l.src[l.cur_pos]
+
+func (l *Lexer) position() token.Position {
+    return token.Position{
+        File: l.file,
+        Line: l.line,
+        Column: l.col,
+        Offset: l.cur_pos,
+    }
 }
 
-func (l *Lexer) peekAssert(expected byte) bool {
-    if l.src[l.next_pos] == expected {
-        return true
+func (l *Lexer) peek() rune {
+    if int(l.next_pos) >= len(l.src) {
+        return 0
     }
-    return false
+    r,_ := utf8.DecodeRune(l.src[l.next_pos:])
+    return r
 }
 
-func (l *Lexer) isLetter() bool {
-    if l.ch >= 'a' && 'z' >= l.ch || l.ch >= 'A' && 'Z' >= l.ch {
+func (l *Lexer) peekAssert(expected rune) bool {
+    if l.peek() == expected {
         return true
     }
     return false
 }
+
+// isLetter reports whether r can start an identifier: any Unicode letter
+// or an underscore. After the first rune, digits are allowed too.
+func isLetter(r rune) bool {
+    return r == '_' || unicode.IsLetter(r)
+}
+func isIdentRune(r rune) bool {
+    return isLetter(r) || unicode.IsDigit(r)
+}
 func (l *Lexer) getWord() string {
     start := l.cur_pos
-    for l.isLetter() { l.Incr() }
-    s := string(l.src[start:l.cur_pos])
-    l.decr()
-    return s
+    for isIdentRune(l.peek()) { l.Incr() }
+    return string(l.src[start:l.next_pos])
 }
 
-func (l *Lexer) isNum() bool {
-    if '0' <= l.ch && '9' >= l.ch {
-        return true
-    }
-    return false
+// isNum only accepts ASCII digits, other scripts' digits can't start a
+// number.
+func isNum(r rune) bool {
+    return '0' <= r && '9' >= r
 }
 func (l *Lexer) getNum() string {
     start := l.cur_pos
-    for l.isNum() { l.Incr() }
-    s := string(l.src[start:l.cur_pos])
-    l.decr()
-    return s
+    for isNum(l.peek()) { l.Incr() }
+    return string(l.src[start:l.next_pos])
+}
+
+func (l *Lexer) atEnd() bool {
+    return int(l.cur_pos) >= len(l.src)
+}
+
+// text returns the source from start up to and including the current rune.
+func (l *Lexer) text(start uint32) string {
+    if l.atEnd() {
+        return string(l.src[start:])
+    }
+    return string(l.src[start:l.next_pos])
+}
+
+// getString reads a string literal starting at its opening quote and
+// returns its value with escape sequences decoded. The lexer is left on the
+// closing quote. ok is false if the string is unterminated or holds an
+// invalid escape, each of which is reported as a lexer error.
+func (l *Lexer) getString() (string, bool) {
+    var sb strings.Builder
+    start := l.position()
+    valid := true
+    for {
+        l.Incr()
+        if l.atEnd() {
+            l.addError(start, "unterminated string literal")
+            return sb.String(), false
+        }
+        switch l.ch {
+            case '"': return sb.String(), valid
+            case '\\': {
+                escape := l.position()
+                l.Incr()
+                switch l.ch {
+                    case 'n': sb.WriteByte('\n')
+                    case 't': sb.WriteByte('\t')
+                    case 'r': sb.WriteByte('\r')
+                    case '"': sb.WriteByte('"')
+                    case '\\': sb.WriteByte('\\')
+                    case 'u': {
+                        r,ok := l.getUnicodeEscape()
+                        if !ok {
+                            l.addError(escape, "invalid unicode escape")
+                            valid = false
+                        }
+                        sb.WriteRune(r)
+                    }
+                    default: {
+                        if l.atEnd() {
+                            l.addError(start, "unterminated string literal")
+                            return sb.String(), false
+                        }
+                        l.addError(escape, "invalid escape sequence '\\%c'", l.ch)
+                        valid = false
+                    }
+                }
+            }
+            default: sb.WriteRune(l.ch)
+        }
+    }
+}
+
+// getUnicodeEscape reads the "{XXXX}" part of a \u{XXXX} escape and leaves
+// the lexer on the closing brace. A malformed escape never steps onto the
+// quote that ends the string.
+func (l *Lexer) getUnicodeEscape() (rune, bool) {
+    if l.peek() != '{' {
+        return utf8.RuneError, false
+    }
+    l.Incr()
+    start := l.next_pos
+    for l.peek() != '}' {
+        if l.peek() == '"' || l.peek() == 0 {
+            return utf8.RuneError, false
+        }
+        l.Incr()
+    }
+    code,err := strconv.ParseUint(string(l.src[start:l.next_pos]), 16, 32)
+    l.Incr()
+    if err != nil || !utf8.ValidRune(rune(code)) {
+        return utf8.RuneError, false
+    }
+    return rune(code), true
+}
+
+func (l *Lexer) isCommentStart() bool {
+    return l.ch == '/' && (l.peek() == '/' || l.peek() == '*')
+}
+
+// getComment reads a "//" comment up to the end of its line, or a "/* */"
+// comment up to its closing "*/", and leaves the lexer on its last rune.
+// ok is false if a block comment is never closed.
+func (l *Lexer) getComment() (string, bool) {
+    start := l.cur_pos
+    if l.peek() == '/' {
+        for l.peek() != '\n' && l.peek() != 0 {
+            l.Incr()
+        }
+        return strings.TrimRight(string(l.src[start:l.next_pos]), "\r"), true
+    }
+
+    pos := l.position()
+    l.Incr()
+    for {
+        l.Incr()
+        if l.atEnd() {
+            l.addError(pos, "unterminated block comment")
+            return string(l.src[start:]), false
+        }
+        if l.ch == '*' && l.peek() == '/' {
+            break
+        }
+    }
+    l.Incr()
+    return string(l.src[start:l.next_pos]), true
 }
 
 func (l *Lexer) isWhitespace() bool {
@@ -79,29 +245,66 @@ func (l *Lexer) isWhitespace() bool {
     return false
 }
 func (l *Lexer) consumeWhitespace() {
+    newlines := 0
     for l.isWhitespace() {
+        if l.ch == '\n' {
+            newlines++
+        }
         l.Incr()
     }
+    if newlines > 1 && l.keepComments {
+        if l.blankLines == nil {
+            l.blankLines = map[uint32]bool{}
+        }
+        l.blankLines[l.cur_pos] = true
+    }
 }
 
 func (l *Lexer) NextToken() token.Token {
     l.consumeWhitespace()
     tok := token.NewToken()
+    tok.Start = l.position()
     switch l.ch {
         case '+': tok.SetToken("+", token.Op_plus) 
         case '-': tok.SetToken("-", token.Op_minus)
         case '*': tok.SetToken("*", token.Op_asterisk)
-        case '/': tok.SetToken("/", token.Op_slash)
+        case '/':{
+            if !l.isCommentStart() {
+                tok.SetToken("/", token.Op_slash)
+                break
+            }
+            comment,ok := l.getComment()
+            if !ok {
+                tok.SetToken(comment, token.Illegal)
+            } else if l.keepComments {
+                tok.SetToken(comment, token.Comment)
+            } else {
+                l.Incr()
+                return l.NextToken()
+            }
+        }
         case '{': tok.SetToken("{", token.Syn_lbrace)
         case '}': tok.SetToken("}", token.Syn_rbrace)
+        case '[': tok.SetToken("[", token.Syn_lbracket)
+        case ']': tok.SetToken("]", token.Syn_rbracket)
         case '(': tok.SetToken("(", token.Syn_lparen)
         case ')': tok.SetToken(")", token.Syn_rparen)
         case '<': tok.SetToken("<", token.Op_lessthan)
         case '>': tok.SetToken(">", token.Op_greaterthan)
         case ';': tok.SetToken(";", token.Syn_semicolon)
         case ',': tok.SetToken(",", token.Syn_comma)
+        case ':': tok.SetToken(":", token.Syn_colon)
         case 0: tok.SetToken("", token.Eof)
 
+        case '"':{
+            start := l.cur_pos
+            if s,ok := l.getString(); ok {
+                tok.SetToken(s, token.Type_string)
+            } else {
+                tok.SetToken(l.text(start), token.Illegal)
+            }
+        }
+
         case '=':{
             if l.peekAssert('=') {
                 tok.SetToken("==", token.Op_equal)
@@ -120,15 +323,31 @@ func (l *Lexer) NextToken() token.Token {
         }
 
         default:{
-            if l.isLetter() {
+            if isLetter(l.ch) {
                 tok.SetWord(l.getWord())
-            } else if l.isNum() {
+            } else if isNum(l.ch) {
+                start := l.cur_pos
                 tok.SetToken(l.getNum(), token.Type_int)
+                // a number running straight into a letter, like 4x
+                if isIdentRune(l.peek()) {
+                    l.getWord()
+                    tok.SetToken(l.text(start), token.Illegal)
+                    l.addError(tok.Start, "invalid numeric literal '%s'", tok.Literal)
+                } else if _,err := strconv.ParseInt(tok.Literal, 10, 64); err != nil {
+                    // too large for an integer
+                    tok.SetToken(tok.Literal, token.Illegal)
+                    l.addError(tok.Start, "invalid numeric literal '%s'", tok.Literal)
+                }
             } else {
-                tok.SetToken("", token.Illegal)
+                tok.SetToken(l.text(l.cur_pos), token.Illegal)
             }
         }
     }
     l.Incr()
+
+    tok.End = l.position()
+    if tok.TokenType == token.Eof {
+        tok.End = tok.Start
+    }
     return tok
 }
@@ -16,9 +16,10 @@ func TestLexer(t *testing.T) {
         };
         
         let result = add(five, ten);
-        !-/*5; 5 < 10 > 5;
+        !-/ *5; 5 < 10 > 5;
         if (5 < 10) { return true; } else { return false; }
         10 == 10; 10 != 9;
+        [1, 2];
         `
 
     tests := []token.Token {
@@ -111,6 +112,14 @@ func TestLexer(t *testing.T) {
         { TokenType: token.Type_int, Literal: "9" },
         { TokenType: token.Syn_semicolon, Literal: ";" },
 
+        //arrays
+        { TokenType: token.Syn_lbracket, Literal: "[" },
+        { TokenType: token.Type_int, Literal: "1" },
+        { TokenType: token.Syn_comma, Literal: "," },
+        { TokenType: token.Type_int, Literal: "2" },
+        { TokenType: token.Syn_rbracket, Literal: "]" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+
         // eof
         { TokenType: token.Eof, Literal: "" },
     };
@@ -126,3 +135,235 @@ func TestLexer(t *testing.T) {
         }
     }
 }
+
+func TestTokenPositions(t *testing.T) {
+    input := "let x = 10;\n  x == 5;\n"
+
+    tests := []struct {
+        literal string
+        start token.Position
+        end token.Position
+    } {
+        { "let", token.Position{ File: "a.monkey", Line: 1, Column: 1, Offset: 0 }, token.Position{ File: "a.monkey", Line: 1, Column: 4, Offset: 3 } },
+        { "x", token.Position{ File: "a.monkey", Line: 1, Column: 5, Offset: 4 }, token.Position{ File: "a.monkey", Line: 1, Column: 6, Offset: 5 } },
+        { "=", token.Position{ File: "a.monkey", Line: 1, Column: 7, Offset: 6 }, token.Position{ File: "a.monkey", Line: 1, Column: 8, Offset: 7 } },
+        { "10", token.Position{ File: "a.monkey", Line: 1, Column: 9, Offset: 8 }, token.Position{ File: "a.monkey", Line: 1, Column: 11, Offset: 10 } },
+        { ";", token.Position{ File: "a.monkey", Line: 1, Column: 11, Offset: 10 }, token.Position{ File: "a.monkey", Line: 1, Column: 12, Offset: 11 } },
+        { "x", token.Position{ File: "a.monkey", Line: 2, Column: 3, Offset: 14 }, token.Position{ File: "a.monkey", Line: 2, Column: 4, Offset: 15 } },
+        { "==", token.Position{ File: "a.monkey", Line: 2, Column: 5, Offset: 16 }, token.Position{ File: "a.monkey", Line: 2, Column: 7, Offset: 18 } },
+        { "5", token.Position{ File: "a.monkey", Line: 2, Column: 8, Offset: 19 }, token.Position{ File: "a.monkey", Line: 2, Column: 9, Offset: 20 } },
+        { ";", token.Position{ File: "a.monkey", Line: 2, Column: 9, Offset: 20 }, token.Position{ File: "a.monkey", Line: 2, Column: 10, Offset: 21 } },
+        { "", token.Position{ File: "a.monkey", Line: 3, Column: 1, Offset: 22 }, token.Position{ File: "a.monkey", Line: 3, Column: 1, Offset: 22 } },
+    }
+
+    lex := NewFile("a.monkey", []byte(input))
+    for _,test := range tests {
+        tok := lex.NextToken()
+        if test.literal != tok.Literal {
+            t.Fatalf("Expected Literal:%s got:%s\n", test.literal, tok.Literal)
+        }
+        if test.start != tok.Start {
+            t.Fatalf("Expected start of '%s':%+v got:%+v\n", test.literal, test.start, tok.Start)
+        }
+        if test.end != tok.End {
+            t.Fatalf("Expected end of '%s':%+v got:%+v\n", test.literal, test.end, tok.End)
+        }
+    }
+}
+
+func TestStringLiterals(t *testing.T) {
+    input := `"foobar" "foo bar" "" "a\nb\t\"c\"\\" "\u{48}\u{e9}\u{1F600}" "bad\q" "\u{zz}" "\u{41" x "open`
+
+    tests := []token.Token {
+        { TokenType: token.Type_string, Literal: "foobar" },
+        { TokenType: token.Type_string, Literal: "foo bar" },
+        { TokenType: token.Type_string, Literal: "" },
+        { TokenType: token.Type_string, Literal: "a\nb\t\"c\"\\" },
+        { TokenType: token.Type_string, Literal: "Hé😀" },
+        { TokenType: token.Illegal, Literal: `"bad\q"` },
+        { TokenType: token.Illegal, Literal: `"\u{zz}"` },
+        { TokenType: token.Illegal, Literal: `"\u{41"` },
+        { TokenType: token.Type_identifier, Literal: "x" },
+        { TokenType: token.Illegal, Literal: `"open` },
+        { TokenType: token.Eof, Literal: "" },
+    }
+
+    lex := New([]byte(input))
+    for _,test := range tests {
+        tok := lex.NextToken()
+        if test.Literal != tok.Literal {
+            t.Fatalf("Expected Literal:%q got:%q\n", test.Literal, tok.Literal)
+        }
+        if test.TokenType != tok.TokenType {
+            t.Fatalf("Expected type:%s got:%s\n", token.TypeName(test.TokenType), token.TypeName(tok.TokenType))
+        }
+    }
+}
+
+func TestComments(t *testing.T) {
+    input := `// leading
+let a = 1; // trailing
+/* block
+   comment */ a / 2;
+/*/ still a comment */
+/* unterminated`
+
+    skipped := []token.Token {
+        { TokenType: token.Keyw_let, Literal: "let" },
+        { TokenType: token.Type_identifier, Literal: "a" },
+        { TokenType: token.Syn_assign, Literal: "=" },
+        { TokenType: token.Type_int, Literal: "1" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+        { TokenType: token.Type_identifier, Literal: "a" },
+        { TokenType: token.Op_slash, Literal: "/" },
+        { TokenType: token.Type_int, Literal: "2" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+        { TokenType: token.Illegal, Literal: "/* unterminated" },
+        { TokenType: token.Eof, Literal: "" },
+    }
+    kept := []token.Token {
+        { TokenType: token.Comment, Literal: "// leading" },
+        { TokenType: token.Keyw_let, Literal: "let" },
+        { TokenType: token.Type_identifier, Literal: "a" },
+        { TokenType: token.Syn_assign, Literal: "=" },
+        { TokenType: token.Type_int, Literal: "1" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+        { TokenType: token.Comment, Literal: "// trailing" },
+        { TokenType: token.Comment, Literal: "/* block\n   comment */" },
+        { TokenType: token.Type_identifier, Literal: "a" },
+        { TokenType: token.Op_slash, Literal: "/" },
+        { TokenType: token.Type_int, Literal: "2" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+        { TokenType: token.Comment, Literal: "/*/ still a comment */" },
+        { TokenType: token.Illegal, Literal: "/* unterminated" },
+        { TokenType: token.Eof, Literal: "" },
+    }
+
+    for _,keep := range []bool{ false, true } {
+        tests := skipped
+        if keep {
+            tests = kept
+        }
+        lex := New([]byte(input))
+        lex.KeepComments(keep)
+        for _,test := range tests {
+            tok := lex.NextToken()
+            if test.Literal != tok.Literal {
+                t.Fatalf("Expected Literal:%q got:%q\n", test.Literal, tok.Literal)
+            }
+            if test.TokenType != tok.TokenType {
+                t.Fatalf("Expected type:%s got:%s\n", token.TypeName(test.TokenType), token.TypeName(tok.TokenType))
+            }
+        }
+    }
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+    input := `let naïve = my_var + x2 * _tmp; "héllo" π9 ₃ 4x`
+
+    tests := []token.Token {
+        { TokenType: token.Keyw_let, Literal: "let" },
+        { TokenType: token.Type_identifier, Literal: "naïve" },
+        { TokenType: token.Syn_assign, Literal: "=" },
+        { TokenType: token.Type_identifier, Literal: "my_var" },
+        { TokenType: token.Op_plus, Literal: "+" },
+        { TokenType: token.Type_identifier, Literal: "x2" },
+        { TokenType: token.Op_asterisk, Literal: "*" },
+        { TokenType: token.Type_identifier, Literal: "_tmp" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+        { TokenType: token.Type_string, Literal: "héllo" },
+        { TokenType: token.Type_identifier, Literal: "π9" },
+        { TokenType: token.Illegal, Literal: "₃" },
+        { TokenType: token.Illegal, Literal: "4x" },
+        { TokenType: token.Eof, Literal: "" },
+    }
+
+    lex := New([]byte(input))
+    for _,test := range tests {
+        tok := lex.NextToken()
+        if test.Literal != tok.Literal {
+            t.Fatalf("Expected Literal:%q got:%q\n", test.Literal, tok.Literal)
+        }
+        if test.TokenType != tok.TokenType {
+            t.Fatalf("Expected type:%s got:%s\n", token.TypeName(test.TokenType), token.TypeName(tok.TokenType))
+        }
+    }
+}
+
+func TestRuneColumns(t *testing.T) {
+    // columns count runes, offsets count bytes
+    input := "\"é\" + naïve;"
+
+    tests := []struct {
+        literal string
+        column uint32
+        offset uint32
+    } {
+        { "é", 1, 0 },
+        { "+", 5, 5 },
+        { "naïve", 7, 7 },
+        { ";", 12, 13 },
+    }
+
+    lex := New([]byte(input))
+    for _,test := range tests {
+        tok := lex.NextToken()
+        if test.literal != tok.Literal {
+            t.Fatalf("Expected Literal:%s got:%s\n", test.literal, tok.Literal)
+        }
+        if test.column != tok.Start.Column || test.offset != tok.Start.Offset {
+            t.Fatalf("Expected '%s' at column %d offset %d, got:%+v\n", test.literal, test.column, test.offset, tok.Start)
+        }
+    }
+}
+
+func TestLexerErrors(t *testing.T) {
+    input := "let a = 12ab;\n@ \"x\\q\" \"\\u{zz}\" 99999999999999999999 /* open \"abc"
+
+    tokens := []token.Token {
+        { TokenType: token.Keyw_let, Literal: "let" },
+        { TokenType: token.Type_identifier, Literal: "a" },
+        { TokenType: token.Syn_assign, Literal: "=" },
+        { TokenType: token.Illegal, Literal: "12ab" },
+        { TokenType: token.Syn_semicolon, Literal: ";" },
+        { TokenType: token.Illegal, Literal: "@" },
+        { TokenType: token.Illegal, Literal: `"x\q"` },
+        { TokenType: token.Illegal, Literal: `"\u{zz}"` },
+        { TokenType: token.Illegal, Literal: "99999999999999999999" },
+        { TokenType: token.Illegal, Literal: `/* open "abc` },
+        { TokenType: token.Eof, Literal: "" },
+    }
+    errors := []string {
+        "1:9: invalid numeric literal '12ab'",
+        "2:5: invalid escape sequence '\\q'",
+        "2:10: invalid unicode escape",
+        "2:18: invalid numeric literal '99999999999999999999'",
+        "2:39: unterminated block comment",
+    }
+
+    lex := New([]byte(input))
+    for _,test := range tokens {
+        tok := lex.NextToken()
+        if test.Literal != tok.Literal {
+            t.Fatalf("Expected Literal:%q got:%q\n", test.Literal, tok.Literal)
+        }
+        if test.TokenType != tok.TokenType {
+            t.Fatalf("Expected type:%s got:%s\n", token.TypeName(test.TokenType), token.TypeName(tok.TokenType))
+        }
+    }
+
+    if len(lex.Errors()) != len(errors) {
+        t.Fatalf("Expected %d errors, got:%v", len(errors), lex.Errors())
+    }
+    for i,e := range lex.Errors() {
+        if e.Error() != errors[i] {
+            t.Fatalf("Expected error:%q got:%q", errors[i], e.Error())
+        }
+    }
+
+    lex = New([]byte(`"abc`))
+    lex.NextToken()
+    if len(lex.Errors()) != 1 || lex.Errors()[0].Error() != "1:1: unterminated string literal" {
+        t.Fatalf("Expected an unterminated string error, got:%v", lex.Errors())
+    }
+}
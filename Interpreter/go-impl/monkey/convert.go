@@ -0,0 +1,362 @@
+package monkey
+
+import (
+	"fmt"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"reflect"
+)
+
+var (
+    errorType = reflect.TypeOf((*error)(nil)).Elem()
+    objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+)
+
+// go to object {{{
+func toObject(name string, val any) (object.Object, error) {
+    if val == nil {
+        return object.NULL, nil
+    }
+    if obj,ok := val.(object.Object); ok {
+        return obj, nil
+    }
+
+    v := reflect.ValueOf(val)
+    switch v.Kind() {
+        case reflect.Bool: return object.NewBoolean(v.Bool()), nil
+        case reflect.String: return &object.String{ Value: v.String() }, nil
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return &object.Integer{ Value: v.Int() }, nil
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            if v.Uint() > 1<<63 - 1 {
+                return nil, fmt.Errorf("%s: %d overflows a script integer", name, v.Uint())
+            }
+            return &object.Integer{ Value: int64(v.Uint()) }, nil
+        case reflect.Slice, reflect.Array: {
+            elems := make([]object.Object, v.Len())
+            for j := range elems {
+                elem,err := toObject(name, v.Index(j).Interface())
+                if err != nil {
+                    return nil, err
+                }
+                elems[j] = elem
+            }
+            return &object.Array{ Elements: elems }, nil
+        }
+        case reflect.Map: {
+            pairs := make(map[object.HashKey]object.HashPair, v.Len())
+            iter := v.MapRange()
+            for iter.Next() {
+                key,err := toObject(name, iter.Key().Interface())
+                if err != nil {
+                    return nil, err
+                }
+                hashable,ok := key.(object.Hashable)
+                if !ok {
+                    return nil, fmt.Errorf("%s: unusable as hash key: %s", name, key.Type())
+                }
+                val,err := toObject(name, iter.Value().Interface())
+                if err != nil {
+                    return nil, err
+                }
+                pairs[hashable.HashKey()] = object.HashPair{ Key: key, Value: val }
+            }
+            return &object.Hash{ Pairs: pairs }, nil
+        }
+        case reflect.Func: {
+            if v.IsNil() {
+                return object.NULL, nil
+            }
+            return wrapFunc(name, v)
+        }
+        case reflect.Pointer, reflect.Interface: {
+            if v.IsNil() {
+                return object.NULL, nil
+            }
+            return toObject(name, v.Elem().Interface())
+        }
+    }
+    return nil, fmt.Errorf("%s: unsupported Go type %s", name, v.Type())
+}
+
+// wrapFunc turns a Go function into a builtin. The function may return
+// nothing, a value, an error, or a value and an error.
+func wrapFunc(name string, fn reflect.Value) (object.Object, error) {
+    ft := fn.Type()
+    switch ft.NumOut() {
+        case 0, 1: {}
+        case 2: {
+            if ft.Out(1) != errorType {
+                return nil, fmt.Errorf("%s: second result of a function must be error", name)
+            }
+        }
+        default: return nil, fmt.Errorf("%s: functions may return at most two results", name)
+    }
+
+    call := func(args ...object.Object) object.Object {
+        fixed := ft.NumIn()
+        if ft.IsVariadic() {
+            fixed--
+            if len(args) < fixed {
+                return object.NewError("wrong number of arguments: want at least %d, got=%d", fixed, len(args))
+            }
+        } else if err := object.CheckArgCount(args, fixed); err != nil {
+            return err
+        }
+
+        in := make([]reflect.Value, len(args))
+        for j,arg := range args {
+            var pt reflect.Type
+            if j < fixed {
+                pt = ft.In(j)
+            } else {
+                pt = ft.In(fixed).Elem()
+            }
+            v,err := toGo(arg, pt)
+            if err != nil {
+                return object.NewError("argument %d to `%s`: %s", j+1, name, err)
+            }
+            in[j] = v
+        }
+
+        out,cerr := callGo(fn, in)
+        if cerr != nil {
+            return errorObject(cerr)
+        }
+        if len(out) == 0 {
+            return object.NULL
+        }
+        last := out[len(out)-1]
+        if ft.Out(len(out)-1) == errorType {
+            if !last.IsNil() {
+                return object.NewError("%s", last.Interface().(error).Error())
+            }
+            if len(out) == 1 {
+                return object.NULL
+            }
+        }
+        res,err := toObject(name, out[0].Interface())
+        if err != nil {
+            return object.NewError("%s", err.Error())
+        }
+        return res
+    }
+    return &object.Builtin{ Name: name, Fn: call }, nil
+}
+
+// callbackError carries a script error out of a function built by makeFunc
+// whose type has no error result to return it through.
+type callbackError struct {
+    err error
+}
+
+// callGo calls a Go function for a builtin. A script function it was given
+// and called may have failed with no way to say so but panicking, which
+// callGo turns back into an error.
+func callGo(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            cb,ok := r.(callbackError)
+            if !ok {
+                panic(r)
+            }
+            err = cb.err
+        }
+    }()
+    return fn.Call(in), nil
+}
+
+// errorObject turns an error back into an error object, keeping the
+// position of a script error.
+func errorObject(err error) *object.Error {
+    if rerr,ok := err.(*RuntimeError); ok {
+        return &object.Error{ Message: rerr.Message, Pos: rerr.Pos }
+    }
+    return object.NewError("%s", err.Error())
+}
+// }}}
+
+// object to go {{{
+func fromObject(obj object.Object) any {
+    switch obj := obj.(type) {
+        case *object.Integer: return obj.Value
+        case *object.Boolean: return obj.Value
+        case *object.String: return obj.Value
+        case *object.Null: return nil
+        case *object.Array: {
+            elems := make([]any, len(obj.Elements))
+            for i,e := range obj.Elements {
+                elems[i] = fromObject(e)
+            }
+            return elems
+        }
+        case *object.Hash: {
+            m := make(map[any]any, len(obj.Pairs))
+            for _,p := range obj.Pairs {
+                m[fromObject(p.Key)] = fromObject(p.Value)
+            }
+            return m
+        }
+        case *object.Function, *object.Builtin: {
+            return func(args ...any) (any, error) {
+                in := make([]object.Object, len(args))
+                for i,a := range args {
+                    arg,err := toObject("argument", a)
+                    if err != nil {
+                        return nil, err
+                    }
+                    in[i] = arg
+                }
+                res := evaluator.ApplyFunction(obj, in)
+                if e,ok := res.(*object.Error); ok {
+                    return nil, newRuntimeError(e)
+                }
+                return fromObject(res), nil
+            }
+        }
+    }
+    return obj
+}
+
+// toGo converts obj to a value of type t, for passing to a Go function.
+func toGo(obj object.Object, t reflect.Type) (reflect.Value, error) {
+    if reflect.TypeOf(obj).AssignableTo(t) && t.Implements(objectType) {
+        return reflect.ValueOf(obj), nil
+    }
+    if t.Kind() == reflect.Interface {
+        v := fromObject(obj)
+        if v == nil {
+            return reflect.Zero(t), nil
+        }
+        rv := reflect.ValueOf(v)
+        if !rv.Type().AssignableTo(t) {
+            return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+        }
+        return rv, nil
+    }
+
+    mismatch := fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+    switch t.Kind() {
+        case reflect.Bool: {
+            b,ok := obj.(*object.Boolean)
+            if !ok {
+                return reflect.Value{}, mismatch
+            }
+            return reflect.ValueOf(b.Value).Convert(t), nil
+        }
+        case reflect.String: {
+            s,ok := obj.(*object.String)
+            if !ok {
+                return reflect.Value{}, mismatch
+            }
+            return reflect.ValueOf(s.Value).Convert(t), nil
+        }
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64: {
+            i,ok := obj.(*object.Integer)
+            if !ok {
+                return reflect.Value{}, mismatch
+            }
+            v := reflect.New(t).Elem()
+            if v.OverflowInt(i.Value) {
+                return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+            }
+            v.SetInt(i.Value)
+            return v, nil
+        }
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64: {
+            i,ok := obj.(*object.Integer)
+            if !ok {
+                return reflect.Value{}, mismatch
+            }
+            v := reflect.New(t).Elem()
+            if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+                return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+            }
+            v.SetUint(uint64(i.Value))
+            return v, nil
+        }
+        case reflect.Slice: {
+            arr,ok := obj.(*object.Array)
+            if !ok {
+                return reflect.Value{}, mismatch
+            }
+            v := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+            for i,e := range arr.Elements {
+                elem,err := toGo(e, t.Elem())
+                if err != nil {
+                    return reflect.Value{}, err
+                }
+                v.Index(i).Set(elem)
+            }
+            return v, nil
+        }
+        case reflect.Map: {
+            hash,ok := obj.(*object.Hash)
+            if !ok {
+                return reflect.Value{}, mismatch
+            }
+            v := reflect.MakeMapWithSize(t, len(hash.Pairs))
+            for _,p := range hash.Pairs {
+                key,err := toGo(p.Key, t.Key())
+                if err != nil {
+                    return reflect.Value{}, err
+                }
+                val,err := toGo(p.Value, t.Elem())
+                if err != nil {
+                    return reflect.Value{}, err
+                }
+                v.SetMapIndex(key, val)
+            }
+            return v, nil
+        }
+        case reflect.Func: {
+            if obj.Type() != object.Obj_function && obj.Type() != object.Obj_builtin {
+                return reflect.Value{}, mismatch
+            }
+            return makeFunc(obj, t), nil
+        }
+    }
+    return reflect.Value{}, mismatch
+}
+
+// makeFunc builds a Go function of type t that calls a script function.
+// Script errors are returned through a trailing error result if t has one.
+// Otherwise the function panics with them, and callGo recovers the panic
+// when the Go function that was handed it returns, failing the builtin.
+func makeFunc(fn object.Object, t reflect.Type) reflect.Value {
+    return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+        out := make([]reflect.Value, t.NumOut())
+        for i := range out {
+            out[i] = reflect.Zero(t.Out(i))
+        }
+        fail := func(err error) []reflect.Value {
+            if len(out) == 0 || t.Out(len(out)-1) != errorType {
+                panic(callbackError{ err: err })
+            }
+            out[len(out)-1] = reflect.ValueOf(&err).Elem()
+            return out
+        }
+
+        in := make([]object.Object, len(args))
+        for i,a := range args {
+            arg,err := toObject("argument", a.Interface())
+            if err != nil {
+                return fail(err)
+            }
+            in[i] = arg
+        }
+        res := evaluator.ApplyFunction(fn, in)
+        if e,ok := res.(*object.Error); ok {
+            return fail(newRuntimeError(e))
+        }
+        if len(out) > 0 && t.Out(0) != errorType {
+            v,err := toGo(res, t.Out(0))
+            if err != nil {
+                return fail(err)
+            }
+            out[0] = v
+        }
+        return out
+    })
+}
+// }}}
@@ -0,0 +1,140 @@
+// Package monkey embeds the interpreter in a Go program. It wires the
+// lexer, parser and evaluator together and converts values between Go and
+// the script's runtime objects.
+package monkey
+
+import (
+	"context"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/token"
+	"strings"
+)
+
+// Value is a script value converted to Go. Integers come back as int64,
+// booleans as bool, strings as string, null as nil, arrays as []any, hashes
+// as map[any]any and functions as func(...any) (any, error).
+type Value = any
+
+type Options struct {
+    // File is reported in the positions of syntax and runtime errors.
+    File string
+    // Globals are bound before any script runs, as if passed to Set.
+    Globals map[string]any
+}
+
+// Interp holds the global scope of a script session. Bindings made by one
+// call to Eval are visible to the next. An Interp must not be used from
+// more than one goroutine at a time.
+type Interp struct {
+    opts Options
+    env *object.Environment
+}
+
+// SyntaxError holds every error the parser reported for a source, each a
+// parser.ParseError.
+type SyntaxError struct {
+    Errors []error
+}
+
+func (e *SyntaxError) Error() string {
+    msgs := make([]string, len(e.Errors))
+    for i,err := range e.Errors {
+        msgs[i] = err.Error()
+    }
+    return strings.Join(msgs, "\n")
+}
+
+// RuntimeError is an error object that a script evaluated to. Pos is set
+// when the error was raised by an operator, such as a division by zero.
+type RuntimeError struct {
+    Message string
+    Pos token.Position
+}
+
+func newRuntimeError(e *object.Error) *RuntimeError {
+    return &RuntimeError{ Message: e.Message, Pos: e.Pos }
+}
+
+func (e *RuntimeError) Error() string {
+    if e.Pos.Line == 0 {
+        return e.Message
+    }
+    return e.Pos.String() + ": " + e.Message
+}
+
+func NewInterpreter(opts Options) (*Interp, error) {
+    interp := &Interp{
+        opts: opts,
+        env: object.NewEnvironment(),
+    }
+    for name,val := range opts.Globals {
+        if err := interp.Set(name, val); err != nil {
+            return nil, err
+        }
+    }
+    return interp, nil
+}
+
+// Eval parses and runs src, and returns the value of its last statement.
+// The context is checked before every statement at the top level and every
+// function call, so a cancelled context stops even a script stuck in a
+// long recursion, and Eval returns the context's error.
+func (i *Interp) Eval(ctx context.Context, src string) (Value, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+
+    lex := lexer.NewFile(i.opts.File, []byte(src))
+    p := parser.New(&lex)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        return nil, &SyntaxError{ Errors: errs }
+    }
+
+    calls := i.env.Calls()
+    calls.Ctx = ctx
+    defer func() { calls.Ctx = nil }()
+
+    var result object.Object = object.NULL
+    for _,stmt := range program.Statements {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        result = evaluator.Eval(stmt, i.env)
+        if ret,ok := result.(*object.ReturnValue); ok {
+            result = ret.Value
+            break
+        }
+        if e,ok := result.(*object.Error); ok {
+            if err := ctx.Err(); err != nil {
+                return nil, err
+            }
+            return nil, newRuntimeError(e)
+        }
+    }
+    return fromObject(result), nil
+}
+
+// Set binds a Go value to name in the global scope. Go functions become
+// builtins that convert their arguments and results on every call. A nil
+// function, like a nil pointer, becomes null.
+func (i *Interp) Set(name string, val any) error {
+    obj,err := toObject(name, val)
+    if err != nil {
+        return err
+    }
+    i.env.Set(name, obj)
+    return nil
+}
+
+// Get returns the Go value bound to name in the global scope.
+func (i *Interp) Get(name string) (Value, bool) {
+    obj,ok := i.env.Get(name)
+    if !ok {
+        return nil, false
+    }
+    return fromObject(obj), true
+}
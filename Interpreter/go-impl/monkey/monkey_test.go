@@ -0,0 +1,185 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"interpreter/parser"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalConversions(t *testing.T) {
+    tests := []struct {
+        input string
+        expected Value
+    } {
+        { "1 + 2;", int64(3) },
+        { "1 < 2;", true },
+        { `"a" + "b";`, "ab" },
+        { "if (false) { 1 };", nil },
+        { `[1, "two", [true]];`, []any{ int64(1), "two", []any{ true } } },
+        { `{"a": 1, 2: false};`, map[any]any{ "a": int64(1), int64(2): false } },
+    }
+
+    interp,err := NewInterpreter(Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _,test := range tests {
+        res,err := interp.Eval(context.Background(), test.input)
+        if err != nil {
+            t.Fatalf("%s: %s", test.input, err)
+        }
+        if !reflect.DeepEqual(res, test.expected) {
+            t.Fatalf("Expected:%#v got:%#v", test.expected, res)
+        }
+    }
+}
+
+func TestSetAndGet(t *testing.T) {
+    var logged []string
+    interp,err := NewInterpreter(Options{
+        Globals: map[string]any {
+            "limit": 3,
+            "names": []string{ "a", "b" },
+            "config": map[string]int{ "retries": 5 },
+            "log": func(msg string) { logged = append(logged, msg) },
+            "sum": func(nums ...int) int {
+                total := 0
+                for _,n := range nums {
+                    total += n
+                }
+                return total
+            },
+            "fail": func() (int, error) { return 0, errors.New("host failure") },
+            "apply": func(f func(int) int, x int) int { return f(x) },
+        },
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    src := `
+    log("start");
+    let total = sum(limit, config["retries"], len(names));
+    let double = fn(x) { x * 2 };
+    let applied = apply(double, 21);
+    log(names[1]);`
+    if _,err := interp.Eval(context.Background(), src); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name string
+        expected Value
+    } {
+        { "total", int64(10) },
+        { "applied", int64(42) },
+    }
+    for _,test := range tests {
+        val,ok := interp.Get(test.name)
+        if !ok || !reflect.DeepEqual(val, test.expected) {
+            t.Fatalf("Expected %s:%#v got:%#v", test.name, test.expected, val)
+        }
+    }
+    if strings.Join(logged, ",") != "start,b" {
+        t.Fatalf("Expected log:start,b got:%s", strings.Join(logged, ","))
+    }
+
+    // script functions can be called from Go
+    double,_ := interp.Get("double")
+    res,err := double.(func(...any) (any, error))(4)
+    if err != nil || res != int64(8) {
+        t.Fatalf("Expected:8 got:%v (%v)", res, err)
+    }
+
+    // errors from Go functions surface as runtime errors
+    _,err = interp.Eval(context.Background(), "fail();")
+    var rerr *RuntimeError
+    if !errors.As(err, &rerr) || rerr.Message != "host failure" {
+        t.Fatalf("Expected runtime error 'host failure' got:%v", err)
+    }
+    // so do script errors inside a Go callback that can't return them
+    _,err = interp.Eval(context.Background(), `apply(fn(x) { x + "a" }, 1);`)
+    if err == nil || err.Error() != "1:17: type mismatch: INTEGER + STRING" {
+        t.Fatalf("Expected type mismatch from the callback got:%v", err)
+    }
+    _,err = interp.Eval(context.Background(), `log(1);`)
+    if err == nil || err.Error() != "argument 1 to `log`: cannot use INTEGER as string" {
+        t.Fatalf("Expected argument error got:%v", err)
+    }
+}
+
+func TestNilFunc(t *testing.T) {
+    var hook func(int) int
+    interp,err := NewInterpreter(Options{ Globals: map[string]any{ "hook": hook } })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := interp.Set("done", (func())(nil)); err != nil {
+        t.Fatal(err)
+    }
+
+    val,err := interp.Eval(context.Background(), "[hook, done];")
+    if err != nil || !reflect.DeepEqual(val, []Value{ nil, nil }) {
+        t.Fatalf("Expected [nil nil] got:%#v (%v)", val, err)
+    }
+    _,err = interp.Eval(context.Background(), "hook(1);")
+    if err == nil || err.Error() != "not a function: NULL" {
+        t.Fatalf("Expected error:not a function: NULL got:%v", err)
+    }
+}
+
+func TestEvalErrors(t *testing.T) {
+    interp,err := NewInterpreter(Options{ File: "host.monkey" })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _,err = interp.Eval(context.Background(), "let = 1;")
+    var serr *SyntaxError
+    if !errors.As(err, &serr) || err.Error() != "host.monkey:1:5: invalid syntax: expected identifier" {
+        t.Fatalf("Expected syntax error got:%v", err)
+    }
+    if perr,ok := serr.Errors[0].(parser.ParseError); !ok || perr.Code != parser.Err_unexpectedToken {
+        t.Fatalf("Expected a ParseError got:%#v", serr.Errors[0])
+    }
+
+    _,err = interp.Eval(context.Background(), "let n = 0;\n10 / n;")
+    var rerr *RuntimeError
+    if !errors.As(err, &rerr) || err.Error() != "host.monkey:2:4: division by zero: 10 / 0" {
+        t.Fatalf("Expected runtime error got:%v", err)
+    }
+
+    _,err = interp.Eval(context.Background(), "let f = fn(n) { f(n + 1) }; f(0);")
+    if !errors.As(err, &rerr) || rerr.Message != "stack overflow" {
+        t.Fatalf("Expected stack overflow got:%v", err)
+    }
+
+    ctx,cancel := context.WithCancel(context.Background())
+    cancel()
+    if _,err := interp.Eval(ctx, "1;"); !errors.Is(err, context.Canceled) {
+        t.Fatalf("Expected context.Canceled got:%v", err)
+    }
+
+    // a single long running statement still notices the deadline
+    ctx,cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    src := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(60);"
+    if _,err := interp.Eval(ctx, src); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("Expected context.DeadlineExceeded got:%v", err)
+    }
+    if elapsed := time.Since(start); elapsed > 5*time.Second {
+        t.Fatalf("Expected the script to stop at its deadline, ran for %s", elapsed)
+    }
+    if res,err := interp.Eval(context.Background(), "fib(10);"); err != nil || res != int64(55) {
+        t.Fatalf("Expected:55 after a cancelled run got:%v (%v)", res, err)
+    }
+
+    if err := interp.Set("ch", make(chan int)); err == nil {
+        t.Fatal("Expected an error for an unsupported Go type")
+    }
+}
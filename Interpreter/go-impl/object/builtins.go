@@ -0,0 +1,145 @@
+package object
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+    builtinsMu sync.RWMutex
+    builtins = map[string]*Builtin {
+        "len": { Name: "len", Fn: builtinLen },
+        "first": { Name: "first", Fn: builtinFirst },
+        "last": { Name: "last", Fn: builtinLast },
+        "rest": { Name: "rest", Fn: builtinRest },
+        "push": { Name: "push", Fn: builtinPush },
+    }
+)
+
+// RegisterBuiltin makes a Go function callable from scripts under name,
+// replacing any builtin already registered under it. Identifiers resolve
+// against the script's own bindings first, so a script can still shadow it.
+func RegisterBuiltin(name string, fn BuiltinFunction) {
+    builtinsMu.Lock()
+    defer builtinsMu.Unlock()
+    builtins[name] = &Builtin{ Name: name, Fn: fn }
+}
+
+// UnregisterBuiltin removes the builtin registered under name, if any.
+func UnregisterBuiltin(name string) {
+    builtinsMu.Lock()
+    defer builtinsMu.Unlock()
+    delete(builtins, name)
+}
+
+// LookupBuiltin returns the builtin registered under name.
+func LookupBuiltin(name string) (*Builtin, bool) {
+    builtinsMu.RLock()
+    defer builtinsMu.RUnlock()
+    b,ok := builtins[name]
+    return b, ok
+}
+
+// CheckArgCount returns an error object if a builtin got other than want
+// arguments, and nil otherwise.
+func CheckArgCount(args []Object, want int) *Error {
+    if len(args) != want {
+        return NewError("wrong number of arguments: want=%d, got=%d", want, len(args))
+    }
+    return nil
+}
+
+// CheckArgType returns an error object if the i'th argument of the builtin
+// called name is none of the wanted types, and nil otherwise.
+func CheckArgType(name string, args []Object, i int, want ...ObjectType) *Error {
+    if i >= len(args) {
+        return NewError("missing argument %d to `%s`", i+1, name)
+    }
+    for _,typ := range want {
+        if args[i].Type() == typ {
+            return nil
+        }
+    }
+
+    names := make([]string, len(want))
+    for j,typ := range want {
+        names[j] = string(typ)
+    }
+    return NewError("argument to `%s` must be %s, got %s", name, strings.Join(names, " or "), args[i].Type())
+}
+
+// len counts the characters of a string, not its bytes.
+func builtinLen(args ...Object) Object {
+    if err := CheckArgCount(args, 1); err != nil {
+        return err
+    }
+    if err := CheckArgType("len", args, 0, Obj_string, Obj_array); err != nil {
+        return err
+    }
+    switch arg := args[0].(type) {
+        case *String: return &Integer{ Value: int64(utf8.RuneCountInString(arg.Value)) }
+        case *Array: return &Integer{ Value: int64(len(arg.Elements)) }
+    }
+    return NULL
+}
+
+func builtinFirst(args ...Object) Object {
+    arr,err := arrayArg("first", args)
+    if err != nil {
+        return err
+    }
+    if len(arr.Elements) == 0 {
+        return NULL
+    }
+    return arr.Elements[0]
+}
+
+func builtinLast(args ...Object) Object {
+    arr,err := arrayArg("last", args)
+    if err != nil {
+        return err
+    }
+    if len(arr.Elements) == 0 {
+        return NULL
+    }
+    return arr.Elements[len(arr.Elements)-1]
+}
+
+func builtinRest(args ...Object) Object {
+    arr,err := arrayArg("rest", args)
+    if err != nil {
+        return err
+    }
+    if len(arr.Elements) == 0 {
+        return NULL
+    }
+    elems := make([]Object, len(arr.Elements)-1)
+    copy(elems, arr.Elements[1:])
+    return &Array{ Elements: elems }
+}
+
+// push returns a new array, the one passed in is left untouched.
+func builtinPush(args ...Object) Object {
+    if err := CheckArgCount(args, 2); err != nil {
+        return err
+    }
+    if err := CheckArgType("push", args, 0, Obj_array); err != nil {
+        return err
+    }
+    arr := args[0].(*Array)
+    elems := make([]Object, len(arr.Elements)+1)
+    copy(elems, arr.Elements)
+    elems[len(arr.Elements)] = args[1]
+    return &Array{ Elements: elems }
+}
+
+func arrayArg(name string, args []Object) (*Array, *Error) {
+    if err := CheckArgCount(args, 1); err != nil {
+        return nil, err
+    }
+    if err := CheckArgType(name, args, 0, Obj_array); err != nil {
+        return nil, err
+    }
+    return args[0].(*Array), nil
+}
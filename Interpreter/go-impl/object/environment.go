@@ -0,0 +1,70 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"interpreter/ast"
+)
+
+// Environment holds the bindings of a single scope. Lookups that miss fall
+// through to the enclosing scope, so function bodies can see the bindings of
+// the scope they were defined in.
+type Environment struct {
+    store map[string]Object
+    outer *Environment
+    calls *CallStack
+}
+
+// MaxCallDepth bounds how deeply script functions can call each other, in
+// the evaluator and the vm alike, so runaway recursion fails with a stack
+// overflow error rather than exhausting the Go stack.
+const MaxCallDepth = 1024
+
+// CallStack tracks the function calls running in a global scope and the
+// scopes it encloses, which all share one.
+type CallStack struct {
+    Depth int
+    // Ctx, if set, is checked on every call, so a script stops soon after
+    // it is cancelled.
+    Ctx context.Context
+}
+
+func NewEnvironment() *Environment {
+    return &Environment{
+        store: make(map[string]Object),
+        outer: nil,
+        calls: &CallStack{},
+    }
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+    return &Environment{
+        store: make(map[string]Object),
+        outer: outer,
+        calls: outer.calls,
+    }
+}
+
+func (e *Environment) Calls() *CallStack {
+    return e.calls
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+    obj,ok := e.store[name]
+    if !ok && e.outer != nil {
+        return e.outer.Get(name)
+    }
+    return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+    e.store[name] = val
+    return val
+}
+
+func (e *Environment) Resolve(ident *ast.Identifier) Object {
+    if obj,ok := e.Get(ident.Value); ok {
+        return obj
+    }
+    return &Error{ Message: fmt.Sprintf("identifier not found: %s", ident.Token.Literal) }
+}
@@ -0,0 +1,61 @@
+package object
+
+import (
+	"interpreter/ast"
+	"interpreter/token"
+	"testing"
+)
+
+func ident(name string) *ast.Identifier {
+    return &ast.Identifier{
+        Token: token.Token{ Literal: name, TokenType: token.Type_identifier },
+        Value: name,
+    }
+}
+
+func TestEnclosedEnvironment(t *testing.T) {
+    outer := NewEnvironment()
+    outer.Set("a", &Integer{ Value: 1 })
+    outer.Set("b", &Integer{ Value: 2 })
+
+    inner := NewEnclosedEnvironment(outer)
+    inner.Set("b", &Integer{ Value: 3 })
+
+    tests := []struct {
+        env *Environment
+        name string
+        expected int64
+    } {
+        { inner, "a", 1 },
+        { inner, "b", 3 },
+        { outer, "b", 2 },
+    }
+
+    for _,test := range tests {
+        obj := test.env.Resolve(ident(test.name))
+        i,ok := obj.(*Integer)
+        if !ok {
+            t.Fatalf("Expected:Integer got:%s (%s)", obj.Type(), obj.Inspect())
+        }
+        if i.Value != test.expected {
+            t.Fatalf("Expected:%d got:%d", test.expected, i.Value)
+        }
+    }
+
+    inner.Set("c", &Integer{ Value: 4 })
+    if _,ok := outer.Get("c"); ok {
+        t.Fatal("outer scope should not see inner bindings")
+    }
+}
+
+func TestIdentifierNotFound(t *testing.T) {
+    env := NewEnclosedEnvironment(NewEnvironment())
+    obj := env.Resolve(ident("missing"))
+    e,ok := obj.(*Error)
+    if !ok {
+        t.Fatalf("Expected:Error got:%s (%s)", obj.Type(), obj.Inspect())
+    }
+    if e.Message != "identifier not found: missing" {
+        t.Fatalf("Expected:'identifier not found: missing' got:'%s'", e.Message)
+    }
+}
@@ -0,0 +1,254 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/token"
+	"sort"
+	"strings"
+)
+
+type ObjectType string
+
+const (
+    Obj_integer ObjectType = "INTEGER"
+    Obj_boolean ObjectType = "BOOLEAN"
+    Obj_string ObjectType = "STRING"
+    Obj_null ObjectType = "NULL"
+    Obj_return ObjectType = "RETURN_VALUE"
+    Obj_error ObjectType = "ERROR"
+    Obj_function ObjectType = "FUNCTION"
+    Obj_builtin ObjectType = "BUILTIN"
+    Obj_array ObjectType = "ARRAY"
+    Obj_hash ObjectType = "HASH"
+    Obj_compiledFunction ObjectType = "COMPILED_FUNCTION"
+)
+
+// booleans and null carry no state of their own, so every evaluation shares
+// these instead of allocating a fresh object
+var (
+    TRUE = &Boolean{ Value: true }
+    FALSE = &Boolean{ Value: false }
+    NULL = &Null{}
+)
+
+func NewBoolean(b bool) *Boolean {
+    if b {
+        return TRUE
+    }
+    return FALSE
+}
+
+type Object interface {
+    Type() ObjectType
+    Inspect() string
+}
+
+// HashKey identifies a value used as a hash key. Equal values always give
+// equal keys, and the type keeps 1 and true apart.
+type HashKey struct {
+    Type ObjectType
+    Value uint64
+}
+
+type Hashable interface {
+    Object
+    HashKey() HashKey
+}
+
+type Integer struct {
+    Value int64
+}
+func (i *Integer) Type() ObjectType { return Obj_integer }
+func (i *Integer) Inspect() string {
+    return fmt.Sprintf("%d", i.Value)
+}
+func (i *Integer) HashKey() HashKey {
+    return HashKey{ Type: i.Type(), Value: uint64(i.Value) }
+}
+
+type Boolean struct {
+    Value bool
+}
+func (b *Boolean) Type() ObjectType { return Obj_boolean }
+func (b *Boolean) Inspect() string {
+    return fmt.Sprintf("%t", b.Value)
+}
+func (b *Boolean) HashKey() HashKey {
+    if b.Value {
+        return HashKey{ Type: b.Type(), Value: 1 }
+    }
+    return HashKey{ Type: b.Type(), Value: 0 }
+}
+
+type String struct {
+    Value string
+}
+func (s *String) Type() ObjectType { return Obj_string }
+func (s *String) Inspect() string {
+    return s.Value
+}
+func (s *String) HashKey() HashKey {
+    h := fnv.New64a()
+    h.Write([]byte(s.Value))
+    return HashKey{ Type: s.Type(), Value: h.Sum64() }
+}
+
+type Null struct {}
+func (n *Null) Type() ObjectType { return Obj_null }
+func (n *Null) Inspect() string {
+    return "null"
+}
+
+type ReturnValue struct {
+    Value Object
+}
+func (r *ReturnValue) Type() ObjectType { return Obj_return }
+func (r *ReturnValue) Inspect() string {
+    return r.Value.Inspect()
+}
+
+type Error struct {
+    Message string
+    // Token is the operator that failed and Pos is where it appears in
+    // the source, for errors raised by an operator. Pos is zero otherwise.
+    Token token.Token
+    Pos token.Position
+}
+func (e *Error) Type() ObjectType { return Obj_error }
+func (e *Error) Inspect() string {
+    return "ERROR: " + e.Message
+}
+
+// Error makes an error object usable as a Go error, prefixed with its
+// position when it has one.
+func (e *Error) Error() string {
+    if e.Pos.Line == 0 {
+        return e.Message
+    }
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func NewError(format string, a ...any) *Error {
+    return &Error{ Message: fmt.Sprintf(format, a...) }
+}
+
+type Function struct {
+    Parameters []*ast.Identifier
+    Body *ast.BlockStatement
+    Env *Environment
+}
+func (f *Function) Type() ObjectType { return Obj_function }
+func (f *Function) Inspect() string {
+    return inspectFunction(f.Parameters, f.Body)
+}
+
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
+    params := make([]string, len(parameters))
+    for i,p := range parameters {
+        params[i] = p.ToString()
+    }
+    return fmt.Sprintf("fn(%s) %s", strings.Join(params, ", "), body.ToString())
+}
+
+// CompiledFunction is a function literal turned into bytecode. It lives in
+// the constant pool, and the vm wraps it in a Closure to call it.
+type CompiledFunction struct {
+    Instructions code.Instructions
+    // Operators maps the offset of each operator instruction to the token
+    // it was compiled from.
+    Operators map[int]token.Token
+    // Locals names each local slot, starting with the parameters.
+    Locals []string
+    // Refs holds the names the function reads that may be bound outside
+    // it, indexed by the operand of Op_getName.
+    Refs []Ref
+    Parameters []*ast.Identifier
+    Body *ast.BlockStatement
+}
+func (f *CompiledFunction) Type() ObjectType { return Obj_compiledFunction }
+func (f *CompiledFunction) Inspect() string {
+    return inspectFunction(f.Parameters, f.Body)
+}
+
+// Ref is a name read inside a compiled function. Slots lists every
+// enclosing function that binds the name, innermost first, and Global is
+// its global slot. The vm takes the first of them that is bound, then the
+// builtin of the same name, which is the order the evaluator looks it up.
+type Ref struct {
+    Name string
+    Slots []Slot
+    Global int
+}
+
+// Slot is a local slot of the function Depth levels out from the one
+// reading it, where 0 is the function itself.
+type Slot struct {
+    Depth int
+    Index int
+}
+
+// Locals holds the bindings of one call of a compiled function, a slot per
+// name the function binds, nil until it is bound. Outer is the call the
+// function was made in. Closures keep the Locals they were made in rather
+// than copying values out of it, so like the evaluator's closures they see
+// a binding that changes after they are made.
+type Locals struct {
+    Slots []Object
+    Outer *Locals
+}
+
+// Closure is a compiled function along with the call it was made in, nil
+// for one made at the top level. To scripts it is just a function, so it
+// shares the evaluator's type.
+type Closure struct {
+    Fn *CompiledFunction
+    Outer *Locals
+}
+func (c *Closure) Type() ObjectType { return Obj_function }
+func (c *Closure) Inspect() string {
+    return c.Fn.Inspect()
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+    Name string
+    Fn BuiltinFunction
+}
+func (b *Builtin) Type() ObjectType { return Obj_builtin }
+func (b *Builtin) Inspect() string {
+    return "builtin " + b.Name
+}
+
+type Array struct {
+    Elements []Object
+}
+func (a *Array) Type() ObjectType { return Obj_array }
+func (a *Array) Inspect() string {
+    elems := make([]string, len(a.Elements))
+    for i,e := range a.Elements {
+        elems[i] = e.Inspect()
+    }
+    return fmt.Sprintf("[%s]", strings.Join(elems, ", "))
+}
+
+type HashPair struct {
+    Key Object
+    Value Object
+}
+
+type Hash struct {
+    Pairs map[HashKey]HashPair
+}
+func (h *Hash) Type() ObjectType { return Obj_hash }
+func (h *Hash) Inspect() string {
+    pairs := make([]string, 0, len(h.Pairs))
+    for _,p := range h.Pairs {
+        pairs = append(pairs, fmt.Sprintf("%s: %s", p.Key.Inspect(), p.Value.Inspect()))
+    }
+    sort.Strings(pairs)
+    return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
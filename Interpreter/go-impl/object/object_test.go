@@ -0,0 +1,27 @@
+package object
+
+import (
+	"testing"
+)
+
+func TestHashKeys(t *testing.T) {
+    tests := []struct {
+        a Hashable
+        b Hashable
+        equal bool
+    } {
+        { &String{ Value: "Hello World" }, &String{ Value: "Hello World" }, true },
+        { &String{ Value: "Hello World" }, &String{ Value: "My name is johnny" }, false },
+        { &Integer{ Value: 1 }, &Integer{ Value: 1 }, true },
+        { &Integer{ Value: 1 }, &Integer{ Value: 2 }, false },
+        { &Integer{ Value: 1 }, TRUE, false },
+        { TRUE, &Boolean{ Value: true }, true },
+        { TRUE, FALSE, false },
+    }
+
+    for _,test := range tests {
+        if (test.a.HashKey() == test.b.HashKey()) != test.equal {
+            t.Fatalf("Expected keys of %s and %s equal:%t", test.a.Inspect(), test.b.Inspect(), test.equal)
+        }
+    }
+}
@@ -0,0 +1,164 @@
+package object
+
+import (
+	"interpreter/token"
+	"math"
+)
+
+// The operators are shared by the evaluator and the vm, so both engines
+// agree on what every one of them does.
+
+// ApplyPrefix applies a prefix operator to an evaluated operand.
+func ApplyPrefix(op string, right Object) Object {
+    switch op {
+        case "!": return NewBoolean(!IsTruthy(right))
+        case "-": {
+            if right.Type() != Obj_integer {
+                return NewError("unknown operator: -%s", right.Type())
+            }
+            value := right.(*Integer).Value
+            if value == math.MinInt64 {
+                return NewError("integer overflow: -(%d)", value)
+            }
+            return &Integer{ Value: -value }
+        }
+    }
+    return NewError("unknown operator: %s%s", op, right.Type())
+}
+
+// Locate points an error raised by an operator at the operator's token.
+// Any other object is returned as it is.
+func Locate(obj Object, op token.Token) Object {
+    if e,ok := obj.(*Error); ok && e.Pos.Line == 0 {
+        e.Token = op
+        e.Pos = op.Start
+    }
+    return obj
+}
+
+// ApplyInfix applies an infix operator to evaluated operands. Integer
+// arithmetic fails on division by zero and on results that don't fit in
+// 64 bits, rather than wrapping around. Values of different types are
+// never equal, so == and != between them give a result, while any other
+// operator fails with a type mismatch. Null only equals null.
+func ApplyInfix(op string, left Object, right Object) Object {
+    switch {
+        case left.Type() == Obj_integer && right.Type() == Obj_integer:
+            return integerInfix(op, left.(*Integer), right.(*Integer))
+        case left.Type() == Obj_string && right.Type() == Obj_string:
+            return stringInfix(op, left.(*String), right.(*String))
+        case left.Type() == Obj_boolean && right.Type() == Obj_boolean:
+            return booleanInfix(op, left.(*Boolean), right.(*Boolean))
+        case left.Type() != right.Type() || left.Type() == Obj_null: {
+            equal := left.Type() == right.Type()
+            switch op {
+                case "==": return NewBoolean(equal)
+                case "!=": return NewBoolean(!equal)
+            }
+            if !equal {
+                return NewError("type mismatch: %s %s %s", left.Type(), op, right.Type())
+            }
+        }
+    }
+    return NewError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+func integerInfix(op string, left *Integer, right *Integer) Object {
+    a,b := left.Value, right.Value
+    overflow := func() Object {
+        return NewError("integer overflow: %d %s %d", a, op, b)
+    }
+    switch op {
+        case "+": {
+            res := a + b
+            if (a^res) & (b^res) < 0 {
+                return overflow()
+            }
+            return &Integer{ Value: res }
+        }
+        case "-": {
+            res := a - b
+            if (a^b) & (a^res) < 0 {
+                return overflow()
+            }
+            return &Integer{ Value: res }
+        }
+        case "*": {
+            res := a * b
+            if a != 0 && (res/a != b || (a == -1 && b == math.MinInt64)) {
+                return overflow()
+            }
+            return &Integer{ Value: res }
+        }
+        case "/": {
+            if b == 0 {
+                return NewError("division by zero: %d / %d", a, b)
+            }
+            if a == math.MinInt64 && b == -1 {
+                return overflow()
+            }
+            return &Integer{ Value: a / b }
+        }
+        case "<": return NewBoolean(left.Value < right.Value)
+        case ">": return NewBoolean(left.Value > right.Value)
+        case "==": return NewBoolean(left.Value == right.Value)
+        case "!=": return NewBoolean(left.Value != right.Value)
+    }
+    return NewError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+func stringInfix(op string, left *String, right *String) Object {
+    switch op {
+        case "+": return &String{ Value: left.Value + right.Value }
+        case "==": return NewBoolean(left.Value == right.Value)
+        case "!=": return NewBoolean(left.Value != right.Value)
+    }
+    return NewError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+func booleanInfix(op string, left *Boolean, right *Boolean) Object {
+    switch op {
+        case "==": return NewBoolean(left.Value == right.Value)
+        case "!=": return NewBoolean(left.Value != right.Value)
+    }
+    return NewError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+}
+
+// ApplyIndex looks index up in an evaluated array or hash.
+func ApplyIndex(left Object, index Object) Object {
+    switch {
+        case left.Type() == Obj_array && index.Type() == Obj_integer:
+            return arrayIndex(left.(*Array), index.(*Integer))
+        case left.Type() == Obj_hash:
+            return hashIndex(left.(*Hash), index)
+    }
+    return NewError("index operator not supported: %s[%s]", left.Type(), index.Type())
+}
+
+func arrayIndex(arr *Array, index *Integer) Object {
+    if index.Value < 0 || index.Value >= int64(len(arr.Elements)) {
+        return NULL
+    }
+    return arr.Elements[index.Value]
+}
+
+func hashIndex(hash *Hash, index Object) Object {
+    hashable,ok := index.(Hashable)
+    if !ok {
+        return NewError("unusable as hash key: %s", index.Type())
+    }
+    if pair,ok := hash.Pairs[hashable.HashKey()]; ok {
+        return pair.Value
+    }
+    return NULL
+}
+
+// IsTruthy reports whether a condition holds: everything but false and
+// null does.
+func IsTruthy(obj Object) bool {
+    switch obj := obj.(type) {
+        case *Null: return false
+        case *Boolean: return obj.Value
+    }
+    return true
+}
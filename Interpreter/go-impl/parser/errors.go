@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"fmt"
+	"interpreter/token"
+)
+
+type ErrorCode uint32
+
+const (
+    Err_unexpectedToken ErrorCode = iota
+    Err_invalidExpression
+    Err_invalidLiteral
+    Err_illegalToken
+    Err_duplicateParameter
+)
+
+var errorCodeNames = map[ErrorCode]string {
+    Err_unexpectedToken: "unexpected-token",
+    Err_invalidExpression: "invalid-expression",
+    Err_invalidLiteral: "invalid-literal",
+    Err_illegalToken: "illegal-token",
+    Err_duplicateParameter: "duplicate-parameter",
+}
+
+func (c ErrorCode) String() string {
+    if name,ok := errorCodeNames[c]; ok {
+        return name
+    }
+    return "unknown"
+}
+
+// ParseError describes a single syntax error. Token is the token the parser
+// was looking at when it gave up, and Expected lists the token types that
+// would have been accepted in its place, if the parser knows them.
+type ParseError struct {
+    Code ErrorCode
+    Message string
+    Token token.Token
+    Expected []uint32
+    Pos token.Position
+}
+
+func (e ParseError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"interpreter/ast"
 	"interpreter/lexer"
 	"interpreter/token"
@@ -16,6 +17,8 @@ const (
     precidence_Product
     precidence_Prefix
     precidence_Infix
+    precidence_Call
+    precidence_Index
 );
 
 var precidenceMap = map[uint32]int {
@@ -27,7 +30,20 @@ var precidenceMap = map[uint32]int {
     token.Op_minus: precidence_Sum,
     token.Op_asterisk: precidence_Product,
     token.Op_slash: precidence_Product,
+    token.Syn_lparen: precidence_Call,
+    token.Syn_lbracket: precidence_Index,
+}
+
+// PrefixPrecidence is how tightly prefix operators bind to their operand.
+const PrefixPrecidence = precidence_Prefix
 
+// Precidence reports how tightly an infix, call or index token binds to the
+// expression on its left. Other tokens get the lowest precidence.
+func Precidence(tok uint32) int {
+    if pres,ok := precidenceMap[tok]; ok {
+        return pres
+    }
+    return precidence_Lowest
 }
 
 type Parser struct {
@@ -35,7 +51,12 @@ type Parser struct {
     curToken token.Token
     nextToken token.Token
     ast []ast.Statement
-    errors []string
+    errors []ParseError
+    // comments seen by the lexer that aren't attached to a node yet
+    pending []token.Token
+    comments map[ast.Node]*ast.Trivia
+    // how many of the lexer's errors have been copied into errors
+    lexErrors int
 }
 
 func New(lex *lexer.Lexer) Parser {
@@ -49,17 +70,44 @@ func New(lex *lexer.Lexer) Parser {
 
 func (p *Parser) ParseTokens() {
     for p.curToken.TokenType != token.Eof {
+        errCount := len(p.errors)
+        leading := p.leadingComments()
         if node := p.parse(); node != nil {
             p.ast = append(p.ast, node)
+            p.attachComments(node, leading)
+        } else if len(p.errors) > errCount {
+            p.synchronize()
         }
         p.Incr()
     }
 }
 
+// ParseProgram parses the whole source and returns its tree along with
+// every syntax error found, each of them a ParseError.
+func (p *Parser) ParseProgram() (*ast.Program, []error) {
+    p.ParseTokens()
+    errs := make([]error, len(p.errors))
+    for i,e := range p.errors {
+        errs[i] = e
+    }
+    program := &ast.Program{ Statements: p.ast }
+    if len(p.pending) > 0 {
+        p.trivia(program).Inner = p.takeComments(func(token.Token) bool { return true })
+    }
+    program.Comments = p.comments
+    program.BlankLines = p.lex.BlankLines()
+    return program, errs
+}
+
+func (p *Parser) Errors() []ParseError {
+    return p.errors
+}
+
 func (p *Parser) parse() ast.Statement {
     switch p.curToken.TokenType {
         case token.Keyw_let: return p.parseLetStatement()
         case token.Keyw_return: return p.parseReturnStatement()
+        case token.Syn_semicolon: return nil
         default: return p.parseExpressionStatement()
     }
 }
@@ -69,18 +117,15 @@ func (p *Parser) parseLetStatement() ast.Statement {
     stmt := ast.LetStatement {
         Token: p.curToken,
     }
-    p.Incr()
 
     // parse identifier
-    stmt.Identifier = p.parseExpression(precidence_Lowest)
-    if stmt.Identifier == nil {
+    if !p.expectNext(token.Type_identifier, "invalid syntax: expected identifier") {
         return nil
-    } else {
-        p.Incr()
     }
+    stmt.Identifier = p.parseIdentExpression()
 
     // check syntax
-    if !p.assert(token.Syn_assign, "invalid syntax: expected '='") {
+    if !p.expectNext(token.Syn_assign, "invalid syntax: expected '='") {
         return nil
     }
     p.Incr()
@@ -89,12 +134,10 @@ func (p *Parser) parseLetStatement() ast.Statement {
     stmt.Value = p.parseExpression(precidence_Lowest)
     if stmt.Value == nil {
         return nil
-    } else {
-        p.Incr()
     }
 
     // check syntax
-    if !p.assert(token.Syn_semicolon, "invalid syntax: expected ';'") {
+    if !p.expectNext(token.Syn_semicolon, "invalid syntax: expected ';'") {
         return nil
     }
     return &stmt
@@ -109,12 +152,10 @@ func (p *Parser) parseReturnStatement() ast.Statement {
     stmt.Value = p.parseExpression(precidence_Lowest)
     if stmt.Value == nil {
         return nil
-    } else {
-        p.Incr()
     }
 
     // check syntax
-    if !p.assert(token.Syn_semicolon, "invalid syntax: expected ';'") {
+    if !p.expectNext(token.Syn_semicolon, "invalid syntax: expected ';'") {
         return nil
     }
     return &stmt
@@ -127,12 +168,18 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 
     stmt.Value = p.parseExpression(precidence_Lowest)
     if stmt.Value == nil {
-        p.errors = append(p.errors, "could not parse expression")
         return nil
     }
-    p.Incr()
 
-    if !p.assert(token.Syn_semicolon, "invalid syntax: expected ';'") {
+    // the ';' is optional after a block, or before the '}' closing one
+    if p.curToken.TokenType == token.Syn_rbrace || p.nextToken.TokenType == token.Syn_rbrace {
+        if p.nextToken.TokenType == token.Syn_semicolon {
+            p.Incr()
+        }
+        return &stmt
+    }
+
+    if !p.expectNext(token.Syn_semicolon, "invalid syntax: expected ';'") {
         return nil
     }
     return &stmt
@@ -142,19 +189,31 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 var indent int = 0
 // parse expressions {{{
 func (p *Parser) parseExpression(precidence int) ast.Expression {
+    start := p.curToken.Start.Offset
+    leading := p.takeComments(func(c token.Token) bool { return c.Start.Offset < start })
+
     var leftExpr ast.Expression
     switch p.curToken.TokenType {
         case token.Type_identifier: leftExpr = p.parseIdentExpression()
         case token.Type_int: leftExpr = p.parseIntLiteral()
         case token.Type_bool: leftExpr = p.parseBoolLiteral()
+        case token.Type_string: leftExpr = p.parseStringLiteral()
         case token.Op_bang: leftExpr = p.parsePrefixExpression()
         case token.Op_minus: leftExpr = p.parsePrefixExpression()
         case token.Syn_lparen: leftExpr = p.parseParenExpr()
-        default: leftExpr = nil
+        case token.Keyw_fn: leftExpr = p.parseFunctionLiteral()
+        case token.Keyw_if: leftExpr = p.parseIfExpression()
+        case token.Syn_lbracket: leftExpr = p.parseArrayLiteral()
+        case token.Syn_lbrace: leftExpr = p.parseHashLiteral()
+        default: p.unexpectedToken()
     }
     if leftExpr == nil {
         return nil
     }
+    if len(leading) > 0 {
+        t := p.trivia(leftExpr)
+        t.Leading = append(leading, t.Leading...)
+    }
 
     for p.curToken.TokenType != token.Eof && precidence < p.getPrecidence(p.nextToken.TokenType) {
         p.Incr()
@@ -167,6 +226,8 @@ func (p *Parser) parseExpression(precidence int) ast.Expression {
             case token.Op_greaterthan: leftExpr = p.parseInfixExpression(leftExpr)
             case token.Op_equal: leftExpr = p.parseInfixExpression(leftExpr)
             case token.Op_notEqual: leftExpr = p.parseInfixExpression(leftExpr)
+            case token.Syn_lparen: leftExpr = p.parseCallExpression(leftExpr)
+            case token.Syn_lbracket: leftExpr = p.parseIndexExpression(leftExpr)
             default: leftExpr = nil
         }
         if leftExpr == nil {
@@ -188,10 +249,10 @@ func (p *Parser) parseIntLiteral() ast.Expression {
     expr := &ast.IntLiteral{
         Token: p.curToken,
     }
-    if v,err := strconv.Atoi(p.curToken.Literal); err == nil {
-        expr.Value = int64(v)
+    if v,err := strconv.ParseInt(p.curToken.Literal, 10, 64); err == nil {
+        expr.Value = v
     } else {
-        p.errors = append(p.errors, "Invalid int literal")
+        p.addError(Err_invalidLiteral, p.curToken, fmt.Sprintf("invalid numeric literal '%s'", p.curToken.Literal))
     }
     return expr
 }
@@ -236,27 +297,254 @@ func (p *Parser) parseBoolLiteral() ast.Expression {
     }
     b,err := strconv.ParseBool(p.curToken.Literal)
     if err != nil {
-        p.errors = append(p.errors, "Invalid bool literal")
+        p.addError(Err_invalidLiteral, p.curToken, "Invalid bool literal")
         return nil
     }
     expr.Value = b
     return &expr
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+    return &ast.StringLiteral {
+        Token: p.curToken,
+        Value: p.curToken.Literal,
+    }
+}
+
 func (p *Parser) parseParenExpr() ast.Expression {
     p.Incr()
     expr := p.parseExpression(precidence_Lowest)
-
     if expr == nil {
-        p.errors = append(p.errors, "could not parse expression in parens")
         return nil
     }
+    if !p.expectNext(token.Syn_rparen, "invalid syntax: expected ')'") {
+        return nil
+    }
+    return expr
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+    expr := ast.FunctionLiteral {
+        Token: p.curToken,
+    }
+    if !p.expectNext(token.Syn_lparen, "invalid syntax: expected '('") {
+        return nil
+    }
+
+    // parse parameters, each name may only be bound once
+    seen := map[string]bool{}
     if p.nextToken.TokenType != token.Syn_rparen {
-        p.errors = append(p.errors, "invalid syntax: expected ')'")
+        for {
+            if !p.expectNext(token.Type_identifier, "invalid syntax: expected parameter name") {
+                return nil
+            }
+            if seen[p.curToken.Literal] {
+                p.addError(Err_duplicateParameter, p.curToken, fmt.Sprintf("duplicate parameter '%s'", p.curToken.Literal))
+            }
+            seen[p.curToken.Literal] = true
+            expr.Parameters = append(expr.Parameters, &ast.Identifier {
+                Token: p.curToken,
+                Value: p.curToken.Literal,
+            })
+            if p.nextToken.TokenType != token.Syn_comma {
+                break
+            }
+            p.Incr()
+        }
+    }
+    if !p.expectNext(token.Syn_rparen, "invalid syntax: expected ')'") {
+        return nil
+    }
+
+    // parse body
+    if !p.expectNext(token.Syn_lbrace, "invalid syntax: expected '{'") {
+        return nil
+    }
+    expr.Body = p.parseBlock()
+    if expr.Body == nil {
+        return nil
+    }
+    return &expr
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+    expr := ast.IfExpression {
+        Token: p.curToken,
+    }
+    if !p.expectNext(token.Syn_lparen, "invalid syntax: expected '('") {
+        return nil
+    }
+
+    // parse condition
+    expr.Condition = p.parseParenExpr()
+    if expr.Condition == nil {
+        return nil
+    }
+
+    // parse consequence
+    if !p.expectNext(token.Syn_lbrace, "invalid syntax: expected '{'") {
+        return nil
+    }
+    expr.Consequence = p.parseBlock()
+    if expr.Consequence == nil {
         return nil
     }
+
+    // parse alternative, any comments before it trail the consequence
+    if p.nextToken.TokenType != token.Keyw_else {
+        return &expr
+    }
     p.Incr()
-    return expr
+    if between := p.takeComments(func(token.Token) bool { return true }); len(between) > 0 {
+        p.trivia(expr.Consequence).Trailing = between
+    }
+    if !p.expectNext(token.Syn_lbrace, "invalid syntax: expected '{'") {
+        return nil
+    }
+    expr.Alternative = p.parseBlock()
+    if expr.Alternative == nil {
+        return nil
+    }
+    return &expr
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+    expr := ast.CallExpression {
+        Token: p.curToken,
+        Function: function,
+    }
+
+    args,ok := p.parseExpressionList(token.Syn_rparen, "invalid syntax: expected ')'")
+    if !ok {
+        return nil
+    }
+    expr.Arguments = args
+    return &expr
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+    expr := ast.ArrayLiteral {
+        Token: p.curToken,
+    }
+
+    elems,ok := p.parseExpressionList(token.Syn_rbracket, "invalid syntax: expected ']'")
+    if !ok {
+        return nil
+    }
+    expr.Elements = elems
+    return &expr
+}
+
+// parseHashLiteral handles a '{' in expression position. Blocks only ever
+// follow 'fn', 'if' and 'else', which parse them directly, so a brace that
+// starts an expression is always a hash.
+func (p *Parser) parseHashLiteral() ast.Expression {
+    expr := ast.HashLiteral {
+        Token: p.curToken,
+        Pairs: []ast.HashPair{},
+    }
+
+    for p.nextToken.TokenType != token.Syn_rbrace {
+        p.Incr()
+        key := p.parseExpression(precidence_Lowest)
+        if key == nil {
+            return nil
+        }
+        if !p.expectNext(token.Syn_colon, "invalid syntax: expected ':'") {
+            return nil
+        }
+        p.Incr()
+        value := p.parseExpression(precidence_Lowest)
+        if value == nil {
+            return nil
+        }
+        expr.Pairs = append(expr.Pairs, ast.HashPair{ Key: key, Value: value })
+
+        if p.nextToken.TokenType != token.Syn_rbrace && !p.expectNext(token.Syn_comma, "invalid syntax: expected ',' or '}'") {
+            return nil
+        }
+        p.elementComments(value)
+    }
+    p.Incr()
+    return &expr
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+    expr := ast.IndexExpression {
+        Token: p.curToken,
+        Left: left,
+    }
+    p.Incr()
+
+    expr.Index = p.parseExpression(precidence_Lowest)
+    if expr.Index == nil {
+        return nil
+    }
+    if !p.expectNext(token.Syn_rbracket, "invalid syntax: expected ']'") {
+        return nil
+    }
+    return &expr
+}
+
+// parseExpressionList parses comma separated expressions up to the end
+// token, starting on the token that opens the list and leaving the parser
+// on the end token.
+func (p *Parser) parseExpressionList(end uint32, err string) ([]ast.Expression, bool) {
+    list := []ast.Expression{}
+    if p.nextToken.TokenType == end {
+        p.Incr()
+        return list, true
+    }
+
+    p.Incr()
+    for {
+        expr := p.parseExpression(precidence_Lowest)
+        if expr == nil {
+            return nil, false
+        }
+        list = append(list, expr)
+        if p.nextToken.TokenType != token.Syn_comma {
+            p.elementComments(expr)
+            break
+        }
+        p.Incr()
+        p.elementComments(expr)
+        p.Incr()
+    }
+    if !p.expectNext(end, err) {
+        return nil, false
+    }
+    return list, true
+}
+
+// parseBlock parses the statements between a '{' and its matching '}', and
+// leaves the parser on the '}'.
+func (p *Parser) parseBlock() *ast.BlockStatement {
+    block := ast.BlockStatement {
+        Token: p.curToken,
+        Statements: []ast.Statement{},
+    }
+    p.Incr()
+    for p.curToken.TokenType != token.Syn_rbrace {
+        if p.curToken.TokenType == token.Eof {
+            p.addError(Err_unexpectedToken, p.curToken, "invalid syntax: expected '}'", token.Syn_rbrace)
+            return nil
+        }
+        errCount := len(p.errors)
+        leading := p.leadingComments()
+        if node := p.parse(); node != nil {
+            block.Statements = append(block.Statements, node)
+            p.attachComments(node, leading)
+        } else if len(p.errors) > errCount && p.synchronize() {
+            break
+        }
+        p.Incr()
+    }
+    end := p.curToken.Start.Offset
+    if inner := p.takeComments(func(c token.Token) bool { return c.Start.Offset < end }); len(inner) > 0 {
+        p.trivia(&block).Inner = inner
+    }
+    return &block
 }
 //}}}
 
@@ -265,19 +553,181 @@ func (p *Parser) parseParenExpr() ast.Expression {
 func (p *Parser) Incr() {
     p.curToken = p.nextToken
     p.nextToken = p.lex.NextToken()
+    for p.nextToken.TokenType == token.Comment {
+        p.pending = append(p.pending, p.nextToken)
+        p.nextToken = p.lex.NextToken()
+    }
+
+    // the lexer explains an illegal token better than the parser could
+    for _,e := range p.lex.Errors()[p.lexErrors:] {
+        p.errors = append(p.errors, ParseError {
+            Code: Err_illegalToken,
+            Message: e.Message,
+            Token: p.nextToken,
+            Pos: e.Pos,
+        })
+    }
+    p.lexErrors = len(p.lex.Errors())
+}
+
+// comments {{{
+// leadingComments takes the comments before the statement about to be
+// parsed, so blocks inside it can't claim them. An empty statement leaves
+// them for the one after it.
+func (p *Parser) leadingComments() []token.Token {
+    if p.curToken.TokenType == token.Syn_semicolon {
+        return nil
+    }
+    start := p.curToken.Start.Offset
+    return p.takeComments(func(c token.Token) bool {
+        return c.Start.Offset < start
+    })
 }
 
-func (p *Parser) assert(expected uint32, err string) bool {
-    if p.curToken.TokenType == expected {
+// attachComments hands the comments to a statement that was just parsed,
+// leaving the parser on its last token. Pending comments inside it, or on
+// the line it ends on, trail it.
+func (p *Parser) attachComments(stmt ast.Statement, leading []token.Token) {
+    end := p.curToken.End
+    trailing := p.takeComments(func(c token.Token) bool {
+        return c.Start.Offset < end.Offset || c.Start.Line == end.Line
+    })
+    if len(leading) > 0 {
+        p.trivia(stmt).Leading = leading
+    }
+    if len(trailing) > 0 {
+        p.trivia(stmt).Trailing = trailing
+    }
+}
+
+// elementComments gives the element of a list just parsed the comments
+// after it: those before the ',' or closing bracket following it, and those
+// ending the line of the ','. Comments the next element follows on the
+// same line are left to lead it. The parser is on the ',' if there is one.
+func (p *Parser) elementComments(elem ast.Expression) {
+    sep := p.curToken
+    endsLine := p.nextToken.Start.Line != sep.End.Line
+    trailing := p.takeComments(func(c token.Token) bool {
+        if sep.TokenType != token.Syn_comma {
+            return true
+        }
+        return c.Start.Offset < sep.Start.Offset || (endsLine && c.Start.Line == sep.End.Line)
+    })
+    if len(trailing) > 0 {
+        t := p.trivia(elem)
+        t.Trailing = append(t.Trailing, trailing...)
+    }
+}
+
+// takeComments removes the run of pending comments at the front that
+// match keep, and returns them.
+func (p *Parser) takeComments(keep func(token.Token) bool) []token.Token {
+    n := 0
+    for n < len(p.pending) && keep(p.pending[n]) {
+        n++
+    }
+    if n == 0 {
+        return nil
+    }
+    taken := p.pending[:n:n]
+    p.pending = p.pending[n:]
+    return taken
+}
+
+func (p *Parser) trivia(node ast.Node) *ast.Trivia {
+    if p.comments == nil {
+        p.comments = map[ast.Node]*ast.Trivia{}
+    }
+    t,ok := p.comments[node]
+    if !ok {
+        t = &ast.Trivia{}
+        p.comments[node] = t
+    }
+    return t
+}
+// }}}
+
+// expectNext steps onto the next token if it has the expected type. If it
+// doesn't, the parser stays put so the offending token is still ahead of it.
+// An illegal token is named in the error, unless the lexer has already
+// explained it.
+func (p *Parser) expectNext(expected uint32, err string) bool {
+    if p.nextToken.TokenType == expected {
+        p.Incr()
         return true
     }
-    p.errors = append(p.errors, err)
+    if p.nextToken.TokenType == token.Illegal {
+        if p.reportedByLexer(p.nextToken) {
+            return false
+        }
+        err = fmt.Sprintf("%s, got illegal '%s'", err, p.nextToken.Literal)
+    }
+    p.addError(Err_unexpectedToken, p.nextToken, err, expected)
     return false
 }
 
-func (p *Parser) getPrecidence(tok uint32) int {
-    if pres,ok := precidenceMap[tok]; ok {
-        return pres 
+func (p *Parser) unexpectedToken() {
+    if p.curToken.TokenType == token.Eof {
+        p.addError(Err_invalidExpression, p.curToken, "invalid syntax: unexpected end of input")
+        return
     }
-    return precidence_Lowest
+    if p.curToken.TokenType == token.Illegal && p.reportedByLexer(p.curToken) {
+        return
+    }
+    p.addError(Err_invalidExpression, p.curToken, fmt.Sprintf("invalid syntax: unexpected '%s'", p.curToken.Literal))
+}
+
+// synchronize skips the rest of a statement that failed to parse, so the
+// next statement starts from a clean state and one typo only reports one
+// error. It stops on the statement's ';', or just before a '}', 'let' or
+// 'return', stepping over any blocks on the way. It returns true if the
+// statement ran into the '}' closing the enclosing block.
+func (p *Parser) synchronize() bool {
+    last := p.errors[len(p.errors)-1]
+    if p.curToken.TokenType == token.Syn_rbrace && last.Token.Start == p.curToken.Start {
+        return true
+    }
+
+    depth := 0
+    for p.curToken.TokenType != token.Eof {
+        if depth == 0 {
+            if p.curToken.TokenType == token.Syn_semicolon {
+                return false
+            }
+            switch p.nextToken.TokenType {
+                case token.Syn_rbrace, token.Keyw_let, token.Keyw_return, token.Eof: return false
+            }
+        }
+        p.Incr()
+        switch p.curToken.TokenType {
+            case token.Syn_lbrace: depth++
+            case token.Syn_rbrace: depth--
+        }
+    }
+    return false
+}
+
+// reportedByLexer reports whether the lexer already has an error for an
+// illegal token, so the parser doesn't pile a second one on top.
+func (p *Parser) reportedByLexer(tok token.Token) bool {
+    for _,e := range p.errors {
+        if e.Code == Err_illegalToken && e.Token.Start == tok.Start {
+            return true
+        }
+    }
+    return false
+}
+
+func (p *Parser) addError(code ErrorCode, tok token.Token, msg string, expected ...uint32) {
+    p.errors = append(p.errors, ParseError {
+        Code: code,
+        Message: msg,
+        Token: tok,
+        Expected: expected,
+        Pos: tok.Start,
+    })
+}
+
+func (p *Parser) getPrecidence(tok uint32) int {
+    return Precidence(tok)
 }
@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"interpreter/ast"
 	"interpreter/lexer"
+	"interpreter/token"
 	"testing"
 )
 
@@ -24,7 +26,7 @@ func TestLetStatements(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
@@ -49,7 +51,7 @@ func TestReturnStatements(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
@@ -69,7 +71,7 @@ func TestIntLiteralExpressions(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
@@ -93,7 +95,7 @@ func TestPrefixExpressions(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
@@ -123,7 +125,7 @@ func TestInfixExpressions(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
@@ -181,7 +183,7 @@ func TestComplexExpression(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
@@ -206,8 +208,500 @@ func TestBoolLiterals(t *testing.T) {
     }
     if len(p.errors) > 0 {
         for _,e := range p.errors {
-            println(e)
+            println(e.Error())
         }
         t.Fatal()
     }
 }
+
+func TestFunctionLiterals(t *testing.T) {
+    input := `
+    fn() { 1; };
+    fn(x) { x; };
+    fn(x, y) { x + y; };
+    let add = fn(a, b) { let c = a + b; return c; };`
+    tests := []string {
+        "expression stmt:: value:fn() {expression stmt:: value:1}",
+        "expression stmt:: value:fn(x) {expression stmt:: value:x}",
+        "expression stmt:: value:fn(x, y) {expression stmt:: value:(x + y)}",
+        "let stmt:: ident:add value:fn(a, b) {let stmt:: ident:c value:(a + b) return stmt:: value:c}",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    if len(p.ast) != len(tests) {
+        t.Fatalf("Expected %d statements, got:%d", len(tests), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != tests[i] {
+            t.Fatalf("Expected:%s  got:%s", tests[i], node.ToString())
+        }
+    }
+    if len(p.errors) > 0 {
+        for _,e := range p.errors {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+}
+
+func TestCallExpressions(t *testing.T) {
+    input := `
+    add();
+    add(1, 2);
+    add(1, 2 * 3, 4 + 5);
+    a + add(b * c) + d;
+    add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8));
+    fn(x) { x; }(5);
+    -f(x) * 2;`
+    tests := []string {
+        "expression stmt:: value:add()",
+        "expression stmt:: value:add(1, 2)",
+        "expression stmt:: value:add(1, (2 * 3), (4 + 5))",
+        "expression stmt:: value:((a + add((b * c))) + d)",
+        "expression stmt:: value:add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+        "expression stmt:: value:fn(x) {expression stmt:: value:x}(5)",
+        "expression stmt:: value:((-f(x)) * 2)",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    if len(p.ast) != len(tests) {
+        t.Fatalf("Expected %d statements, got:%d", len(tests), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != tests[i] {
+            t.Fatalf("Expected:%s  got:%s", tests[i], node.ToString())
+        }
+    }
+    if len(p.errors) > 0 {
+        for _,e := range p.errors {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+}
+
+func TestIfExpressions(t *testing.T) {
+    input := `
+    if (x < y) { x; }
+    if (x < y) { x } else { y }
+    let max = if (a > b) { a; } else { b; };
+    if (a) { return 1; } else { if (b) { 2; } };
+    fn(x) { fn(y) { x + y } };`
+    tests := []string {
+        "expression stmt:: value:if (x < y) {expression stmt:: value:x}",
+        "expression stmt:: value:if (x < y) {expression stmt:: value:x} else {expression stmt:: value:y}",
+        "let stmt:: ident:max value:if (a > b) {expression stmt:: value:a} else {expression stmt:: value:b}",
+        "expression stmt:: value:if a {return stmt:: value:1} else {expression stmt:: value:if b {expression stmt:: value:2}}",
+        "expression stmt:: value:fn(x) {expression stmt:: value:fn(y) {expression stmt:: value:(x + y)}}",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    if len(p.ast) != len(tests) {
+        t.Fatalf("Expected %d statements, got:%d", len(tests), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != tests[i] {
+            t.Fatalf("Expected:%s  got:%s", tests[i], node.ToString())
+        }
+    }
+    if len(p.errors) > 0 {
+        for _,e := range p.errors {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+}
+
+func TestNodePositions(t *testing.T) {
+    input := "let a = 1;\nreturn a +\n    2;"
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    ret := p.ast[1].(*ast.ReturnStatement)
+    infix := ret.Value.(*ast.InfixExpression)
+    tests := []struct {
+        node ast.Node
+        line uint32
+        column uint32
+    } {
+        { p.ast[0], 1, 1 },
+        { ret, 2, 1 },
+        { infix, 2, 10 },
+        { infix.Left, 2, 8 },
+        { infix.Right, 3, 5 },
+    }
+
+    for _,test := range tests {
+        pos := test.node.Pos()
+        if pos.Line != test.line || pos.Column != test.column {
+            t.Fatalf("Expected %s at %d:%d got:%s", test.node.ToString(), test.line, test.column, pos)
+        }
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    input := "let a 5;\nreturn (1 + 2;"
+    tests := []struct {
+        code ErrorCode
+        literal string
+        expected []uint32
+        line uint32
+        column uint32
+    } {
+        { Err_unexpectedToken, "5", []uint32{ token.Syn_assign }, 1, 7 },
+        { Err_unexpectedToken, ";", []uint32{ token.Syn_rparen }, 2, 14 },
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    errs := []ParseError{}
+    for _,e := range p.Errors() {
+        if e.Code == Err_unexpectedToken {
+            errs = append(errs, e)
+        }
+    }
+    if len(errs) != len(tests) {
+        t.Fatalf("Expected %d errors, got:%d", len(tests), len(errs))
+    }
+    for i,test := range tests {
+        e := errs[i]
+        if e.Code != test.code {
+            t.Fatalf("Expected code:%s got:%s (%s)", test.code, e.Code, e.Error())
+        }
+        if e.Token.Literal != test.literal {
+            t.Fatalf("Expected token:'%s' got:'%s'", test.literal, e.Token.Literal)
+        }
+        if len(e.Expected) != len(test.expected) || e.Expected[0] != test.expected[0] {
+            t.Fatalf("Expected types:%v got:%v", test.expected, e.Expected)
+        }
+        if e.Pos.Line != test.line || e.Pos.Column != test.column {
+            t.Fatalf("Expected position %d:%d got:%s", test.line, test.column, e.Pos)
+        }
+    }
+}
+
+func TestErrorRecovery(t *testing.T) {
+    input := `
+    let a 5;
+    let b = 10;
+    let f = fn(x) {
+        let y = x +;
+        return y * 2;
+    };
+    let g = fn() { 1 } let h = 2;
+    if (a { 1 } else { 2 }
+    return 1 2;
+    let c = (1 + 2;
+    5 + };
+    let d = 3;`
+    tests := []string {
+        "2:11: invalid syntax: expected '='",
+        "5:20: invalid syntax: unexpected ';'",
+        "8:24: invalid syntax: expected ';'",
+        "9:11: invalid syntax: expected ')'",
+        "10:14: invalid syntax: expected ';'",
+        "11:19: invalid syntax: expected ')'",
+        "12:9: invalid syntax: unexpected '}'",
+    }
+    stmts := []string {
+        "let stmt:: ident:b value:10",
+        "let stmt:: ident:f value:fn(x) {return stmt:: value:(y * 2)}",
+        "let stmt:: ident:h value:2",
+        "let stmt:: ident:d value:3",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    errs := p.Errors()
+    if len(errs) != len(tests) {
+        for _,e := range errs {
+            println(e.Error())
+        }
+        t.Fatalf("Expected %d errors, got:%d", len(tests), len(errs))
+    }
+    for i,e := range errs {
+        if e.Error() != tests[i] {
+            t.Fatalf("Expected:'%s' got:'%s'", tests[i], e.Error())
+        }
+    }
+
+    if len(p.ast) != len(stmts) {
+        t.Fatalf("Expected %d statements, got:%d", len(stmts), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != stmts[i] {
+            t.Fatalf("Expected:%s  got:%s", stmts[i], node.ToString())
+        }
+    }
+}
+
+func TestStringLiterals(t *testing.T) {
+    input := `"hello world"; let s = "a" + "b\n";`
+    tests := []string {
+        `expression stmt:: value:"hello world"`,
+        `let stmt:: ident:s value:("a" + "b\n")`,
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    if len(p.ast) != len(tests) {
+        t.Fatalf("Expected %d statements, got:%d", len(tests), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != tests[i] {
+            t.Fatalf("Expected:%s  got:%s", tests[i], node.ToString())
+        }
+    }
+    if len(p.errors) > 0 {
+        for _,e := range p.errors {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+}
+
+func TestArrayAndIndexExpressions(t *testing.T) {
+    input := `
+    [];
+    [1, 2 * 2, 3 + 3];
+    myArray[1 + 1];
+    a * [1, 2, 3, 4][b * c] * d;
+    add(a * b[2], b[1], 2 * [1, 2][1]);
+    f(x)[0];`
+    tests := []string {
+        "expression stmt:: value:[]",
+        "expression stmt:: value:[1, (2 * 2), (3 + 3)]",
+        "expression stmt:: value:(myArray[(1 + 1)])",
+        "expression stmt:: value:((a * ([1, 2, 3, 4][(b * c)])) * d)",
+        "expression stmt:: value:add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+        "expression stmt:: value:(f(x)[0])",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    if len(p.ast) != len(tests) {
+        t.Fatalf("Expected %d statements, got:%d", len(tests), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != tests[i] {
+            t.Fatalf("Expected:%s  got:%s", tests[i], node.ToString())
+        }
+    }
+    if len(p.errors) > 0 {
+        for _,e := range p.errors {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+}
+
+func TestHashLiterals(t *testing.T) {
+    input := `
+    {};
+    {"one": 1, "two": 2, 3: true};
+    {"a": 0 + 1, "b": 10 - 8,};
+    let h = {"k": fn(x) { x }}["k"];
+    {1: 2}`
+    tests := []string {
+        "expression stmt:: value:{}",
+        `expression stmt:: value:{"one": 1, "two": 2, 3: true}`,
+        `expression stmt:: value:{"a": (0 + 1), "b": (10 - 8)}`,
+        `let stmt:: ident:h value:({"k": fn(x) {expression stmt:: value:x}}["k"])`,
+        "expression stmt:: value:{1: 2}",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    p.ParseTokens()
+
+    if len(p.ast) != len(tests) {
+        t.Fatalf("Expected %d statements, got:%d", len(tests), len(p.ast))
+    }
+    for i,node := range p.ast {
+        if node.ToString() != tests[i] {
+            t.Fatalf("Expected:%s  got:%s", tests[i], node.ToString())
+        }
+    }
+    if len(p.errors) > 0 {
+        for _,e := range p.errors {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+}
+
+func TestParseProgram(t *testing.T) {
+    input := "let a = 1;\nreturn a;"
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        for _,e := range errs {
+            println(e.Error())
+        }
+        t.Fatal()
+    }
+
+    expected := "let stmt:: ident:a value:1\nreturn stmt:: value:a"
+    if program.ToString() != expected {
+        t.Fatalf("Expected:%q got:%q", expected, program.ToString())
+    }
+
+    l = lexer.New([]byte("let = 1;"))
+    p = New(&l)
+    _,errs = p.ParseProgram()
+    if len(errs) != 1 {
+        t.Fatalf("Expected 1 error, got:%d", len(errs))
+    }
+    if _,ok := errs[0].(ParseError); !ok {
+        t.Fatalf("Expected a ParseError, got:%T", errs[0])
+    }
+}
+
+func TestComments(t *testing.T) {
+    input := `// about f
+let f = fn(x) {
+    x // the result
+    // end of f
+};
+let h = {"a": 1, // first
+    "b": /* b */ 2};
+if (h) { 1 } // after if
+else { 2 }
+/* the end */`
+
+    l := lexer.New([]byte(input))
+    l.KeepComments(true)
+    p := New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        t.Fatalf("unexpected error:%s", errs[0])
+    }
+
+    literals := func(toks []token.Token) []string {
+        res := []string{}
+        for _,tok := range toks {
+            res = append(res, tok.Literal)
+        }
+        return res
+    }
+    check := func(what string, got []token.Token, expected ...string) {
+        lits := literals(got)
+        if len(lits) != len(expected) {
+            t.Fatalf("%s: Expected:%q got:%q", what, expected, lits)
+        }
+        for i := range expected {
+            if lits[i] != expected[i] {
+                t.Fatalf("%s: Expected:%q got:%q", what, expected, lits)
+            }
+        }
+    }
+
+    let := program.Statements[0]
+    check("leading", program.Comments[let].Leading, "// about f")
+    body := let.(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+    check("trailing", program.Comments[body.Statements[0]].Trailing, "// the result")
+    check("block", program.Comments[body].Inner, "// end of f")
+    hash := program.Statements[1].(*ast.LetStatement).Value.(*ast.HashLiteral)
+    check("element", program.Comments[hash.Pairs[0].Value].Trailing, "// first")
+    check("operand", program.Comments[hash.Pairs[1].Value].Leading, "/* b */")
+    ifExpr := program.Statements[2].(*ast.ExpressionStatement).Value.(*ast.IfExpression)
+    check("consequence", program.Comments[ifExpr.Consequence].Trailing, "// after if")
+    if _,ok := program.Comments[ifExpr.Alternative.Statements[0]]; ok {
+        t.Fatal("Expected no comments in the else block")
+    }
+    check("program", program.Comments[program].Inner, "/* the end */")
+
+    // without KeepComments the lexer drops them before the parser sees them
+    l = lexer.New([]byte(input))
+    p = New(&l)
+    program,_ = p.ParseProgram()
+    if program.Comments != nil {
+        t.Fatalf("Expected no comments, got:%d", len(program.Comments))
+    }
+}
+
+func TestLexerErrors(t *testing.T) {
+    input := "let a = 12ab;\nlet b = \"x\\q\";\n@;\nlet d = 99999999999999999999;\nlet e = 1.5;\nlet c = 3;"
+    tests := []struct {
+        code ErrorCode
+        literal string
+        message string
+    } {
+        { Err_illegalToken, "12ab", "1:9: invalid numeric literal '12ab'" },
+        { Err_illegalToken, `"x\q"`, `2:11: invalid escape sequence '\q'` },
+        { Err_invalidExpression, "@", "3:1: invalid syntax: unexpected '@'" },
+        { Err_illegalToken, "99999999999999999999", "4:9: invalid numeric literal '99999999999999999999'" },
+        { Err_unexpectedToken, ".", "5:10: invalid syntax: expected ';', got illegal '.'" },
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) != len(tests) {
+        t.Fatalf("Expected %d errors, got:%v", len(tests), errs)
+    }
+    for i,test := range tests {
+        e := p.Errors()[i]
+        if e.Code != test.code {
+            t.Fatalf("Expected code:%s got:%s (%s)", test.code, e.Code, e.Error())
+        }
+        if e.Token.Literal != test.literal {
+            t.Fatalf("Expected token:'%s' got:'%s'", test.literal, e.Token.Literal)
+        }
+        if e.Error() != test.message {
+            t.Fatalf("Expected error:%q got:%q", test.message, e.Error())
+        }
+    }
+
+    // the statement after the bad tokens still parses
+    if len(program.Statements) != 1 || program.Statements[0].ToString() != "let stmt:: ident:c value:3" {
+        t.Fatalf("Expected only let c, got:%s", program.ToString())
+    }
+}
+
+func TestDuplicateParameters(t *testing.T) {
+    input := "let f = fn(a, b, a) { a };\nlet g = fn(x, x, x) { x };\nlet h = fn(a, b) { fn(a) { a } };"
+    expected := []string{
+        "1:18: duplicate parameter 'a'",
+        "2:15: duplicate parameter 'x'",
+        "2:18: duplicate parameter 'x'",
+    }
+
+    l := lexer.New([]byte(input))
+    p := New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) != len(expected) {
+        t.Fatalf("Expected %d errors, got:%v", len(expected), errs)
+    }
+    for i,e := range p.Errors() {
+        if e.Code != Err_duplicateParameter || e.Error() != expected[i] {
+            t.Fatalf("Expected error:%q got:%q (%s)", expected[i], e.Error(), e.Code)
+        }
+    }
+
+    // the functions still parse, and shadowing an outer parameter is fine
+    if len(program.Statements) != 3 {
+        t.Fatalf("Expected 3 statements, got:%d", len(program.Statements))
+    }
+}
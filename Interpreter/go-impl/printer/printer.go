@@ -0,0 +1,405 @@
+// Package printer renders a syntax tree back to canonical Monkey source.
+// Parsing the output gives back the same tree.
+package printer
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/parser"
+	"interpreter/token"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const indentUnit = "    "
+
+type printer struct {
+    sb strings.Builder
+    indent int
+    comments map[ast.Node]*ast.Trivia
+    blankLines map[uint32]bool
+}
+
+// Print renders a program, statement or expression. Programs end with a
+// newline, so the output can be written straight back to a file. Comments,
+// and the blank lines separating statements, are only printed for a
+// program parsed with comments kept. Runs of blank lines become one.
+func Print(node ast.Node) string {
+    p := printer{}
+    switch node := node.(type) {
+        case *ast.Program: {
+            p.comments = node.Comments
+            p.blankLines = node.BlankLines
+            p.program(node)
+        }
+        case ast.Statement: p.statement(node)
+        case ast.Expression: p.expression(node, lowest)
+    }
+    return p.sb.String()
+}
+
+func (p *printer) write(s string) {
+    p.sb.WriteString(s)
+}
+
+func (p *printer) newline() {
+    p.write("\n")
+    p.write(strings.Repeat(indentUnit, p.indent))
+}
+
+// statements {{{
+func (p *printer) program(program *ast.Program) {
+    for i,stmt := range p.statementList(program.Statements) {
+        if i > 0 && p.blankBefore(program.Statements[i]) {
+            p.write("\n")
+        }
+        p.leading(program.Statements[i])
+        p.write(stmt)
+        p.trailing(program.Statements[i])
+        p.write("\n")
+    }
+    for i,c := range p.inner(program) {
+        if (i > 0 || len(program.Statements) > 0) && p.blankLines[c.Start.Offset] {
+            p.write("\n")
+        }
+        p.write(c.Literal)
+        p.write("\n")
+    }
+}
+
+// statementList renders each statement on its own. An if statement goes
+// without a ';' unless the next statement starts with something that would
+// continue the if as an expression, like "(" turning it into a call.
+func (p *printer) statementList(stmts []ast.Statement) []string {
+    res := make([]string, len(stmts))
+    for i,stmt := range stmts {
+        sub := printer{ indent: p.indent, comments: p.comments, blankLines: p.blankLines }
+        sub.statement(stmt)
+        res[i] = sub.sb.String()
+    }
+    for i := 0; i+1 < len(stmts); i++ {
+        if isIfStatement(stmts[i]) && strings.ContainsAny(res[i+1][:1], "([-") {
+            res[i] += ";"
+        }
+    }
+    return res
+}
+
+func isIfStatement(stmt ast.Statement) bool {
+    if expr,ok := stmt.(*ast.ExpressionStatement); ok {
+        _,ok = expr.Value.(*ast.IfExpression)
+        return ok
+    }
+    return false
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+    switch stmt := stmt.(type) {
+        case *ast.LetStatement: {
+            p.write("let ")
+            p.expression(stmt.Identifier, lowest)
+            p.write(" = ")
+            p.expression(stmt.Value, lowest)
+            p.write(";")
+        }
+        case *ast.ReturnStatement: {
+            p.write("return ")
+            p.expression(stmt.Value, lowest)
+            p.write(";")
+        }
+        case *ast.ExpressionStatement: {
+            p.expression(stmt.Value, lowest)
+            if !isIfStatement(stmt) {
+                p.write(";")
+            }
+        }
+        case *ast.BlockStatement: p.block(stmt)
+    }
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+    inner := p.inner(block)
+    if len(block.Statements) == 0 && len(inner) == 0 {
+        p.write("{}")
+        return
+    }
+    p.write("{")
+    p.indent++
+    for i,stmt := range p.statementList(block.Statements) {
+        if i > 0 && p.blankBefore(block.Statements[i]) {
+            p.write("\n")
+        }
+        p.newline()
+        p.leading(block.Statements[i])
+        p.write(stmt)
+        p.trailing(block.Statements[i])
+    }
+    for i,c := range inner {
+        if (i > 0 || len(block.Statements) > 0) && p.blankLines[c.Start.Offset] {
+            p.write("\n")
+        }
+        p.newline()
+        p.write(c.Literal)
+    }
+    p.indent--
+    p.newline()
+    p.write("}")
+}
+// }}}
+
+// blankBefore reports whether the source had a blank line before stmt, or
+// before the comments leading it.
+func (p *printer) blankBefore(stmt ast.Statement) bool {
+    if t,ok := p.comments[stmt]; ok && len(t.Leading) > 0 {
+        return p.blankLines[t.Leading[0].Start.Offset]
+    }
+    return p.blankLines[stmt.Pos().Offset]
+}
+
+// comments {{{
+// leading puts each comment before stmt on a line of its own, keeping a
+// blank line wherever the source had one between them.
+func (p *printer) leading(stmt ast.Statement) {
+    t,ok := p.comments[stmt]
+    if !ok {
+        return
+    }
+    for i,c := range t.Leading {
+        p.write(c.Literal)
+        next := stmt.Pos()
+        if i+1 < len(t.Leading) {
+            next = t.Leading[i+1].Start
+        }
+        if p.blankLines[next.Offset] {
+            p.write("\n")
+        }
+        p.newline()
+    }
+}
+
+// trailing puts the comments after node on the same line. Anything after
+// a line comment has to start a new line, or it would become part of it,
+// so trailing reports whether the last comment was one.
+func (p *printer) trailing(node ast.Node) bool {
+    t,ok := p.comments[node]
+    if !ok {
+        return false
+    }
+    for i,c := range t.Trailing {
+        if i > 0 && isLineComment(t.Trailing[i-1]) {
+            p.newline()
+        } else {
+            p.write(" ")
+        }
+        p.write(c.Literal)
+    }
+    return len(t.Trailing) > 0 && isLineComment(t.Trailing[len(t.Trailing)-1])
+}
+
+// leadingInline puts the comments before an operand in front of it, with
+// a line comment ending its line.
+func (p *printer) leadingInline(expr ast.Expression) {
+    t,ok := p.comments[expr]
+    if !ok {
+        return
+    }
+    for _,c := range t.Leading {
+        p.write(c.Literal)
+        if isLineComment(c) {
+            p.newline()
+        } else {
+            p.write(" ")
+        }
+    }
+}
+
+func isLineComment(c token.Token) bool {
+    return strings.HasPrefix(c.Literal, "//")
+}
+
+func (p *printer) hasComments(exprs []ast.Expression) bool {
+    for _,e := range exprs {
+        if _,ok := p.comments[e]; ok {
+            return true
+        }
+    }
+    return false
+}
+
+func (p *printer) inner(node ast.Node) []token.Token {
+    if t,ok := p.comments[node]; ok {
+        return t.Inner
+    }
+    return nil
+}
+// }}}
+
+// expressions {{{
+var (
+    lowest = parser.Precidence(token.Eof)
+    highest = math.MaxInt
+)
+
+// precidence reports how tightly expr holds together, so the printer knows
+// when it needs parens to keep it in one piece.
+func precidence(expr ast.Expression) int {
+    switch expr := expr.(type) {
+        case *ast.InfixExpression: return parser.Precidence(expr.Token.TokenType)
+        case *ast.PrefixExpression: return parser.PrefixPrecidence
+        case *ast.CallExpression: return parser.Precidence(token.Syn_lparen)
+        case *ast.IndexExpression: return parser.Precidence(token.Syn_lbracket)
+    }
+    return highest
+}
+
+// expression prints expr, wrapped in parens if it binds looser than min.
+func (p *printer) expression(expr ast.Expression, min int) {
+    p.leadingInline(expr)
+    if precidence(expr) < min {
+        p.write("(")
+        defer p.write(")")
+    }
+
+    switch expr := expr.(type) {
+        case *ast.Identifier: p.write(expr.Value)
+        case *ast.IntLiteral: p.write(fmt.Sprintf("%d", expr.Value))
+        case *ast.BoolLiteral: p.write(fmt.Sprintf("%t", expr.Value))
+        case *ast.StringLiteral: p.write(quote(expr.Value))
+        case *ast.PrefixExpression: {
+            p.write(expr.Opperator)
+            p.expression(expr.Right, parser.PrefixPrecidence)
+        }
+        case *ast.InfixExpression: {
+            prec := parser.Precidence(expr.Token.TokenType)
+            p.expression(expr.Left, prec)
+            p.write(" " + expr.Opperator + " ")
+            // operators are left associative, so an equal right side needs parens
+            p.expression(expr.Right, prec+1)
+        }
+        case *ast.CallExpression: {
+            p.expression(expr.Function, parser.Precidence(token.Syn_lparen))
+            p.write("(")
+            p.expressionList(expr.Arguments)
+            p.write(")")
+        }
+        case *ast.IndexExpression: {
+            p.expression(expr.Left, parser.Precidence(token.Syn_lbracket))
+            p.write("[")
+            p.expression(expr.Index, lowest)
+            p.write("]")
+        }
+        case *ast.ArrayLiteral: {
+            p.write("[")
+            p.expressionList(expr.Elements)
+            p.write("]")
+        }
+        case *ast.HashLiteral: {
+            exprs := make([]ast.Expression, 0, 2*len(expr.Pairs))
+            for _,pair := range expr.Pairs {
+                exprs = append(exprs, pair.Key, pair.Value)
+            }
+            lines := p.hasComments(exprs)
+            p.write("{")
+            if lines {
+                p.indent++
+            }
+            for i,pair := range expr.Pairs {
+                if lines {
+                    p.newline()
+                } else if i > 0 {
+                    p.write(", ")
+                }
+                p.expression(pair.Key, lowest)
+                p.write(": ")
+                p.expression(pair.Value, lowest)
+                if lines && i+1 < len(expr.Pairs) {
+                    p.write(",")
+                }
+                p.trailing(pair.Value)
+            }
+            if lines {
+                p.indent--
+                p.newline()
+            }
+            p.write("}")
+        }
+        case *ast.FunctionLiteral: {
+            p.write("fn(")
+            for i,param := range expr.Parameters {
+                if i > 0 {
+                    p.write(", ")
+                }
+                p.write(param.Value)
+            }
+            p.write(") ")
+            p.block(expr.Body)
+        }
+        case *ast.IfExpression: {
+            p.write("if (")
+            p.expression(expr.Condition, lowest)
+            p.write(") ")
+            p.block(expr.Consequence)
+            if expr.Alternative != nil {
+                if p.trailing(expr.Consequence) {
+                    p.newline()
+                } else {
+                    p.write(" ")
+                }
+                p.write("else ")
+                p.block(expr.Alternative)
+            }
+        }
+    }
+}
+
+// expressionList prints exprs on one line, or one per line if any of them
+// has comments, so each comment stays beside its own element.
+func (p *printer) expressionList(exprs []ast.Expression) {
+    if !p.hasComments(exprs) {
+        for i,e := range exprs {
+            if i > 0 {
+                p.write(", ")
+            }
+            p.expression(e, lowest)
+        }
+        return
+    }
+
+    p.indent++
+    for i,e := range exprs {
+        p.newline()
+        p.expression(e, lowest)
+        if i+1 < len(exprs) {
+            p.write(",")
+        }
+        p.trailing(e)
+    }
+    p.indent--
+    p.newline()
+}
+// }}}
+
+// quote renders s as a string literal using only escapes the lexer knows.
+func quote(s string) string {
+    var sb strings.Builder
+    sb.WriteByte('"')
+    for _,r := range s {
+        switch r {
+            case '"': sb.WriteString(`\"`)
+            case '\\': sb.WriteString(`\\`)
+            case '\n': sb.WriteString(`\n`)
+            case '\t': sb.WriteString(`\t`)
+            case '\r': sb.WriteString(`\r`)
+            default: {
+                if unicode.IsPrint(r) {
+                    sb.WriteRune(r)
+                } else {
+                    fmt.Fprintf(&sb, `\u{%x}`, r)
+                }
+            }
+        }
+    }
+    sb.WriteByte('"')
+    return sb.String()
+}
@@ -0,0 +1,207 @@
+package printer
+
+import (
+	"interpreter/lexer"
+	"interpreter/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) string {
+    l := lexer.New([]byte(input))
+    p := parser.New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        for _,e := range errs {
+            println(e.Error())
+        }
+        t.Fatalf("could not parse:%s", input)
+    }
+    return Print(program)
+}
+
+func TestPrint(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { "let   a=10 ;", "let a = 10;\n" },
+        { "return a+b*c;", "return a + b * c;\n" },
+        { "(a + b) * c;", "(a + b) * c;\n" },
+        { "a - (b - c); (a - b) - c;", "a - (b - c);\na - b - c;\n" },
+        { "(a < b) > c; a < (b > c);", "(a < b) > c;\na < b > c;\n" },
+        { "-(5 + 5); !(-a); -(-a);", "-(5 + 5);\n!-a;\n--a;\n" },
+        { "(-a)[0]; (f)(x); (a + b)(c);", "(-a)[0];\nf(x);\n(a + b)(c);\n" },
+        { `"a\n\"b\"\\" + "\u{1}";`, "\"a\\n\\\"b\\\"\\\\\" + \"\\u{1}\";\n" },
+        { "[1, 2 * 3][0]; {\"a\": 1, 2: true};", "[1, 2 * 3][0];\n{\"a\": 1, 2: true};\n" },
+        { "let f = fn(a, b) { let c = a + b; c };", "let f = fn(a, b) {\n    let c = a + b;\n    c;\n};\n" },
+        { "fn() {};", "fn() {};\n" },
+        {
+            "if (a > b) { if (c) { return 1; } } else { 2 }",
+            "if (a > b) {\n    if (c) {\n        return 1;\n    }\n} else {\n    2;\n}\n",
+        },
+        { "if (a) { 1 }; (b + 1) * 2;", "if (a) {\n    1;\n};\n(b + 1) * 2;\n" },
+        { "if (a) { 1 }; -b;", "if (a) {\n    1;\n};\n-b;\n" },
+        { "if (a) { 1 } b;", "if (a) {\n    1;\n}\nb;\n" },
+    }
+
+    for _,test := range tests {
+        res := parse(t, test.input)
+        if res != test.expected {
+            t.Fatalf("Expected:%q got:%q", test.expected, res)
+        }
+    }
+}
+
+func TestRoundTrip(t *testing.T) {
+    inputs := []string {
+        "a + b + c; a + (b + c); a * (b + c) / d; 1 - -1;",
+        "5 > 4 == 3 < 4; (5 > 4) == (3 < 4); !(true == true);",
+        "add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8)); fn(x) { x }(5);",
+        "let h = {\"k\": fn(x) { x }}[\"k\"]; [[1], [2]][0][0];",
+        "let max = if (a > b) { a } else { b }; if (x) { y }",
+        "let f = fn(x) { fn(y) { if (x < y) { return y; } x } };",
+    }
+
+    for _,input := range inputs {
+        l := lexer.New([]byte(input))
+        p := parser.New(&l)
+        original,_ := p.ParseProgram()
+
+        printed := Print(original)
+        l = lexer.New([]byte(printed))
+        p = parser.New(&l)
+        reparsed,errs := p.ParseProgram()
+        if len(errs) > 0 {
+            t.Fatalf("could not reparse:%s (%s)", printed, errs[0])
+        }
+        if original.ToString() != reparsed.ToString() {
+            t.Fatalf("Expected:%s got:%s", original.ToString(), reparsed.ToString())
+        }
+        if Print(reparsed) != printed {
+            t.Fatalf("printing is not stable:%q vs %q", printed, Print(reparsed))
+        }
+    }
+}
+
+func TestComments(t *testing.T) {
+    input := `// header
+
+let f = fn(a) { // takes a
+    /* doubled */ a * 2
+    // nothing else
+};
+let x = 1 + /* inline */ 2;
+if (x) {
+    // empty
+}
+/* done */`
+    expected := `// header
+
+let f = fn(a) {
+    // takes a
+    /* doubled */
+    a * 2;
+    // nothing else
+};
+let x = 1 + /* inline */ 2;
+if (x) {
+    // empty
+}
+/* done */
+`
+
+    for _,src := range []string{ input, expected } {
+        l := lexer.New([]byte(src))
+        l.KeepComments(true)
+        p := parser.New(&l)
+        program,errs := p.ParseProgram()
+        if len(errs) > 0 {
+            t.Fatalf("could not parse:%s (%s)", src, errs[0])
+        }
+        if Print(program) != expected {
+            t.Fatalf("Expected:%q got:%q", expected, Print(program))
+        }
+    }
+}
+
+func TestExpressionComments(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        {
+            "let h = {\n  \"a\": 1, // first\n  \"b\": 2 /* second */\n};",
+            "let h = {\n    \"a\": 1, // first\n    \"b\": 2 /* second */\n};\n",
+        },
+        {
+            "if (x) { 1 } // after if\nelse { 2 }",
+            "if (x) {\n    1;\n} // after if\nelse {\n    2;\n}\n",
+        },
+        {
+            "if (x) { 1 } /* then */ else { 2 }",
+            "if (x) {\n    1;\n} /* then */ else {\n    2;\n}\n",
+        },
+        {
+            "f(a, // the first\n  // about b\n  b);",
+            "f(\n    a, // the first\n    // about b\n    b\n);\n",
+        },
+        {
+            "let a = [1, 2 /* two */, 3];",
+            "let a = [\n    1,\n    2, /* two */\n    3\n];\n",
+        },
+        { "let x = -/* neg */ y * /* twice */ (a + b);", "let x = -/* neg */ y * /* twice */ (a + b);\n" },
+        { "let x = // why\n  5;", "let x = // why\n5;\n" },
+        { "[[1, /* deep */ 2]];", "[[\n    1,\n    /* deep */ 2\n]];\n" },
+    }
+
+    for _,test := range tests {
+        printed := ""
+        for _,src := range []string{ test.input, test.expected } {
+            l := lexer.New([]byte(src))
+            l.KeepComments(true)
+            p := parser.New(&l)
+            program,errs := p.ParseProgram()
+            if len(errs) > 0 {
+                t.Fatalf("could not parse:%s (%s)", src, errs[0])
+            }
+            printed = Print(program)
+            if printed != test.expected {
+                t.Fatalf("Expected:%q got:%q", test.expected, printed)
+            }
+        }
+
+        // the comments don't change what the program means
+        l := lexer.New([]byte(test.input))
+        p := parser.New(&l)
+        original,_ := p.ParseProgram()
+        l = lexer.New([]byte(printed))
+        p = parser.New(&l)
+        reparsed,_ := p.ParseProgram()
+        if original.ToString() != reparsed.ToString() {
+            t.Fatalf("Expected:%s got:%s", original.ToString(), reparsed.ToString())
+        }
+    }
+}
+
+func TestBlankLines(t *testing.T) {
+    input := "\n\nlet a = 1;\n\n\n\nlet b = 2;\nlet c = fn() {\n\n    let d = 3;\n\n    // about e\n\n    let e = 4;\n    e;\n\n};\n\n\n/* end */\n"
+    expected := "let a = 1;\n\nlet b = 2;\nlet c = fn() {\n    let d = 3;\n\n    // about e\n\n    let e = 4;\n    e;\n};\n\n/* end */\n"
+
+    for _,src := range []string{ input, expected } {
+        l := lexer.New([]byte(src))
+        l.KeepComments(true)
+        p := parser.New(&l)
+        program,errs := p.ParseProgram()
+        if len(errs) > 0 {
+            t.Fatalf("could not parse:%s (%s)", src, errs[0])
+        }
+        if Print(program) != expected {
+            t.Fatalf("Expected:%q got:%q", expected, Print(program))
+        }
+    }
+
+    // without comments kept, the layout is entirely canonical
+    if res := parse(t, input); res != "let a = 1;\nlet b = 2;\nlet c = fn() {\n    let d = 3;\n    let e = 4;\n    e;\n};\n" {
+        t.Fatalf("Expected no blank lines got:%q", res)
+    }
+}
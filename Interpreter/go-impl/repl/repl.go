@@ -0,0 +1,74 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/token"
+	"io"
+	"strings"
+)
+
+const prompt = ">> "
+
+// Start reads one line at a time from in and evaluates it against a single
+// environment, so bindings made on earlier lines stay visible. Typing
+// ":tokens" toggles a mode that dumps the lexed tokens instead.
+func Start(in io.Reader, out io.Writer) {
+    scanner := bufio.NewScanner(in)
+    env := object.NewEnvironment()
+    dumpTokens := false
+
+    fmt.Fprint(out, "Monkey REPL\n\n")
+    for {
+        fmt.Fprint(out, prompt)
+        if !scanner.Scan() {
+            return
+        }
+        line := scanner.Text()
+
+        switch strings.TrimSpace(line) {
+            case "": continue
+            case ":tokens": {
+                dumpTokens = !dumpTokens
+                continue
+            }
+        }
+
+        if dumpTokens {
+            printTokens(out, line)
+        } else {
+            evalLine(out, line, env)
+        }
+    }
+}
+
+func printTokens(out io.Writer, line string) {
+    lex := lexer.New([]byte(line))
+    for {
+        tok := lex.NextToken()
+        fmt.Fprintf(out, "[type:%s, literal:\"%s\"],\n", token.TypeName(tok.TokenType), tok.Literal)
+        if tok.TokenType == token.Eof {
+            break
+        }
+    }
+    fmt.Fprint(out, "\n")
+}
+
+func evalLine(out io.Writer, line string, env *object.Environment) {
+    lex := lexer.New([]byte(line))
+    p := parser.New(&lex)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        for _,e := range errs {
+            fmt.Fprintf(out, "\t%s\n", e.Error())
+        }
+        return
+    }
+
+    res := evaluator.Eval(program, env)
+    fmt.Fprintln(out, res.Inspect())
+}
@@ -0,0 +1,35 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSessionState(t *testing.T) {
+    input := "let a = 5;\nlet b = a * 2;\nb + 1;\n"
+    expected := "Monkey REPL\n\n>> 5\n>> 10\n>> 11\n>> "
+
+    var out bytes.Buffer
+    Start(strings.NewReader(input), &out)
+    if out.String() != expected {
+        t.Fatalf("Expected:%q got:%q", expected, out.String())
+    }
+}
+
+func TestTokenMode(t *testing.T) {
+    input := ":tokens\nlet x = 1;\n"
+    expected := "Monkey REPL\n\n>> >> " +
+        "[type:Keyw_let, literal:\"let\"],\n" +
+        "[type:Type_identifier, literal:\"x\"],\n" +
+        "[type:Syn_assign, literal:\"=\"],\n" +
+        "[type:Type_int, literal:\"1\"],\n" +
+        "[type:Syn_semicolon, literal:\";\"],\n" +
+        "[type:Eof, literal:\"\"],\n\n>> "
+
+    var out bytes.Buffer
+    Start(strings.NewReader(input), &out)
+    if out.String() != expected {
+        t.Fatalf("Expected:%q got:%q", expected, out.String())
+    }
+}
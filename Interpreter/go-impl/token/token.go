@@ -1,5 +1,9 @@
 package token
 
+import (
+	"fmt"
+)
+
 const (
     Keyw_let uint32 = iota
     Keyw_return
@@ -9,11 +13,14 @@ const (
 
     Syn_semicolon
     Syn_comma
+    Syn_colon
     Syn_assign
     Syn_lparen
     Syn_rparen
     Syn_lbrace
     Syn_rbrace
+    Syn_lbracket
+    Syn_rbracket
 
     Op_plus
     Op_minus
@@ -27,15 +34,37 @@ const (
 
     Type_int
     Type_bool
+    Type_string
     Type_identifier
 
+    Comment
     Eof
     Illegal
 )
 
+// Position points at a single byte of source. Lines and columns start at 1,
+// Offset is the byte index from the start of the source.
+type Position struct {
+    File string
+    Line uint32
+    Column uint32
+    Offset uint32
+}
+
+func (p Position) String() string {
+    if p.File == "" {
+        return fmt.Sprintf("%d:%d", p.Line, p.Column)
+    }
+    return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Start is the position of the first byte of the token, End the position
+// just past its last byte.
 type Token struct {
     Literal string
     TokenType uint32
+    Start Position
+    End Position
 }
 func NewToken() Token {
     return Token{}
@@ -63,3 +92,44 @@ var keywords = map[string]uint32 {
     "true": Type_bool,
     "false": Type_bool,
 }
+
+var typeNames = map[uint32]string {
+    Keyw_let: "Keyw_let",
+    Keyw_return: "Keyw_return",
+    Keyw_fn: "Keyw_fn",
+    Keyw_if: "Keyw_if",
+    Keyw_else: "Keyw_else",
+    Syn_semicolon: "Syn_semicolon",
+    Syn_comma: "Syn_comma",
+    Syn_colon: "Syn_colon",
+    Syn_assign: "Syn_assign",
+    Syn_lparen: "Syn_lparen",
+    Syn_rparen: "Syn_rparen",
+    Syn_lbrace: "Syn_lbrace",
+    Syn_rbrace: "Syn_rbrace",
+    Syn_lbracket: "Syn_lbracket",
+    Syn_rbracket: "Syn_rbracket",
+    Op_plus: "Op_plus",
+    Op_minus: "Op_minus",
+    Op_slash: "Op_slash",
+    Op_asterisk: "Op_asterisk",
+    Op_bang: "Op_bang",
+    Op_equal: "Op_equal",
+    Op_notEqual: "Op_notEqual",
+    Op_lessthan: "Op_lessthan",
+    Op_greaterthan: "Op_greaterthan",
+    Type_int: "Type_int",
+    Type_bool: "Type_bool",
+    Type_string: "Type_string",
+    Type_identifier: "Type_identifier",
+    Comment: "Comment",
+    Eof: "Eof",
+    Illegal: "Illegal",
+}
+
+func TypeName(tType uint32) string {
+    if name,ok := typeNames[tType]; ok {
+        return name
+    }
+    return "Unknown"
+}
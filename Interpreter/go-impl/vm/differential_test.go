@@ -0,0 +1,271 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+// outcome is everything a program can be observed doing: the value it
+// ends with, the error it fails with, and the lines it logs on the way.
+type outcome struct {
+    value string
+    err string
+    log []string
+}
+
+// registerLog registers a log builtin for the length of the test. It
+// appends the arguments of every call to trace, so side effects and the
+// order they happen in can be compared too.
+func registerLog(t *testing.T, trace *[]string) {
+    object.RegisterBuiltin("log", func(args ...object.Object) object.Object {
+        parts := make([]string, len(args))
+        for i,a := range args {
+            parts[i] = a.Inspect()
+        }
+        *trace = append(*trace, strings.Join(parts, " "))
+        if len(args) == 1 {
+            return args[0]
+        }
+        return object.NULL
+    })
+    t.Cleanup(func() { object.UnregisterBuiltin("log") })
+}
+
+// differentialCorpus lists programs with the outcome both engines must
+// agree on. Each one is run through the tree evaluator and the vm. A
+// program the parser refuses fails with its first parse error, before
+// either engine sees it.
+var differentialCorpus = []struct {
+    name string
+    input string
+    expected outcome
+}{
+    // values
+    { "empty", "", outcome{ value: "null" } },
+    { "arithmetic", "(5 + 10 * 2 + 15 / 3) * 2 + -10;", outcome{ value: "50" } },
+    { "integer division", "7 / 2 - -7 / 2;", outcome{ value: "6" } },
+    { "smallest integer", "-9223372036854775807 - 1 < 0;", outcome{ value: "true" } },
+    { "comparisons", "[1 < 2, 1 > 2, 1 == 1, 1 != 1, true == !false, true != true];", outcome{ value: "[true, false, true, false, true, false]" } },
+    { "truthiness", "[!0, !\"\", ![], !!fn() {}, ![][0]];", outcome{ value: "[false, false, false, true, true]" } },
+    { "strings", "let s = \"mon\" + \"key\"; [s, s == \"monkey\", s != \"ape\", len(s)];", outcome{ value: "[monkey, true, true, 6]" } },
+    { "unicode strings", "len(\"héllo\");", outcome{ value: "5" } },
+    { "arrays", "let a = [1, 2 * 3, \"x\"]; [a[0], a[1 + 1], a[3], a[-1], first(a), last(a), rest(a), push(a, 4), a];", outcome{ value: "[1, x, null, null, 1, x, [6, x], [1, 6, x, 4], [1, 6, x]]" } },
+    { "hashes", "let h = {\"a\": 1, 2: \"b\", true: [3]}; [h[\"a\"], h[2], h[true][0], h[false], h];", outcome{ value: "[1, b, 3, null, {2: b, a: 1, true: [3]}]" } },
+    { "equality across types", "[1 == \"1\", 1 != \"1\", true == 1, \"a\" != false, [] == 0, fn() {} != 1];", outcome{ value: "[false, true, false, true, false, true]" } },
+    { "comparing with null", "let h = {\"a\": 1}; [h[\"b\"] == first([]), h[\"a\"] == first([]), h[\"b\"] != h[\"a\"], if (false) { 1 } == h[\"b\"]];", outcome{ value: "[true, false, true, true]" } },
+    { "let value", "let a = 5;", outcome{ value: "5" } },
+    { "rebinding", "let a = 1; let a = a + 1; a;", outcome{ value: "2" } },
+    { "top level return", "1; return 2; 3;", outcome{ value: "2" } },
+    { "return in block", "if (true) { if (true) { return 1; } 2 } 3;", outcome{ value: "1" } },
+
+    // conditionals
+    { "if value", "[if (true) { 1 }, if (false) { 1 }, if (1 > 2) { 1 } else { 2 }, if (true) {}];", outcome{ value: "[1, null, 2, null]" } },
+    { "let in if", "if (true) { let x = 3; } x;", outcome{ value: "3" } },
+
+    // functions
+    { "call", "let add = fn(a, b) { a + b }; add(1, add(2, 3));", outcome{ value: "6" } },
+    { "empty body", "fn() {}();", outcome{ value: "null" } },
+    { "let ends body", "fn(x) { let y = x * 2; }(4);", outcome{ value: "8" } },
+    { "early return", "let f = fn(x) { if (x > 0) { return \"pos\"; } \"neg\" }; [f(1), f(-1)];", outcome{ value: "[pos, neg]" } },
+    { "recursion", "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20);", outcome{ value: "6765" } },
+    { "globals read at call time", "let f = fn() { g * 2 }; let g = 21; f();", outcome{ value: "42" } },
+    { "shadowing", "let x = 1; let f = fn() { let y = x; let x = 10; x + y }; [f(), x];", outcome{ value: "[11, 1]" } },
+    { "first class", "let apply = fn(f, x) { f(x) }; apply(fn(n) { n * n }, 7);", outcome{ value: "49" } },
+    { "builtin values", "let l = len; [l(\"ab\"), l([1])];", outcome{ value: "[2, 1]" } },
+    { "shadowed builtin", "let len = fn(x) { 0 }; len(\"abc\");", outcome{ value: "0" } },
+    { "builtin shadowed after use", "let f = fn() { len }; let len = 5; f();", outcome{ value: "5" } },
+    { "builtin shadowed between calls", "let f = fn() { len(\"ab\") }; let a = f(); let len = fn(x) { 0 }; [a, f()];", outcome{ value: "[2, 0]" } },
+    { "builtin shadowed by a local", "let f = fn() { let a = len(\"ab\"); let len = fn(x) { 0 }; [a, len(\"ab\")] }; f();", outcome{ value: "[2, 0]" } },
+    { "function value", "fn(x) { x + 1 };", outcome{ value: "fn(x) {expression stmt:: value:(x + 1)}" } },
+
+    // closures
+    { "adder", "let adder = fn(x) { fn(y) { x + y } }; let add2 = adder(2); [add2(3), adder(10)(1)];", outcome{ value: "[5, 11]" } },
+    { "nested capture", "let f = fn(a) { let b = a * 2; fn(c) { fn() { a + b + c } } }; f(1)(3)();", outcome{ value: "6" } },
+    { "local recursion", "let f = fn(n) { let go = fn(i, acc) { if (i > n) { acc } else { go(i + 1, acc + i) } }; go(1, 0) }; f(100);", outcome{ value: "5050" } },
+    { "map", "let map = fn(arr, f) { let iter = fn(a, acc) { if (len(a) == 0) { acc } else { iter(rest(a), push(acc, f(first(a)))) } }; iter(arr, []) }; let k = 3; map([1, 2, 3], fn(x) { x * k });", outcome{ value: "[3, 6, 9]" } },
+    { "reduce", "let reduce = fn(arr, init, f) { if (len(arr) == 0) { init } else { reduce(rest(arr), f(init, first(arr)), f) } }; reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x });", outcome{ value: "10" } },
+    { "callbacks", "let on = fn(name, cb) { fn(v) { cb(name, v) } }; let h = on(\"click\", fn(n, v) { log(n, v); v * 2 }); [h(1), h(2)];", outcome{ value: "[2, 4]", log: []string{ "click 1", "click 2" } } },
+    { "local mutual recursion", "let f = fn() { let a = fn(n) { if (n == 0) { 0 } else { b(n - 1) } }; let b = fn(n) { a(n) }; a(3) }; f();", outcome{ value: "0" } },
+    { "local even and odd", "let f = fn(n) { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; [even(n), odd(n)] }; f(7);", outcome{ value: "[false, true]" } },
+    { "rebinding a captured local", "let c = fn() { let n = 0; let inc = fn() { n + 1 }; let n = 10; inc() }; c();", outcome{ value: "11" } },
+    { "captured local bound later", "let f = fn(c) { let g = fn() { x }; if (c) { let x = 1; }; g() }; let x = 2; [f(true), f(false)];", outcome{ value: "[1, 2]" } },
+    { "captured function name", "let f = fn() { let g = fn(n) { let step = fn() { g(n - 1) }; if (n == 0) { \"done\" } else { step() } }; g }; f()(3);", outcome{ value: "done" } },
+    { "capture shadowed by parameter", "let f = fn(x) { fn(x) { x } }; f(1)(2);", outcome{ value: "2" } },
+
+    // deep recursion
+    { "deepest recursion", "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1023);", outcome{ value: "1023" } },
+    { "too deep recursion", "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1024);", outcome{ err: "stack overflow" } },
+    { "infinite recursion", "let f = fn() { f() }; f();", outcome{ err: "stack overflow" } },
+    { "infinite local recursion", "let f = fn() { let g = fn(n) { g(n + 1) }; g(0) }; f();", outcome{ err: "stack overflow" } },
+
+    // side effects
+    { "ignored builtin result", "log(1); 2;", outcome{ value: "2", log: []string{ "1" } } },
+    { "ignored builtin result in function", "let f = fn(x) { log(x); x * 2 }; f(log(3));", outcome{ value: "6", log: []string{ "3", "3" } } },
+    { "argument order", "let f = fn(a, b, c) { c }; f(log(1), log(2), log(3));", outcome{ value: "3", log: []string{ "1", "2", "3" } } },
+    { "operand order", "log(1) + log(2) * log(3);", outcome{ value: "7", log: []string{ "1", "2", "3" } } },
+    { "callee first", "let g = fn() { log(\"g\"); fn(x) { x } }; g()(log(\"arg\"));", outcome{ value: "arg", log: []string{ "g", "arg" } } },
+    { "untaken branch", "if (log(false)) { log(\"then\") } else { log(\"else\") };", outcome{ value: "else", log: []string{ "false", "else" } } },
+    { "literal order", "[log(1), {log(\"k\"): log(\"v\")}, log(2)];", outcome{ value: "[1, {k: v}, 2]", log: []string{ "1", "k", "v", "2" } } },
+    { "index order", "log([1, 2])[log(0)];", outcome{ value: "1", log: []string{ "[1, 2]", "0" } } },
+
+    // errors
+    { "type mismatch", "1 + true;", outcome{ err: "1:3: type mismatch: INTEGER + BOOLEAN" } },
+    { "unknown infix", "\"a\" - \"b\";", outcome{ err: "1:5: unknown operator: STRING - STRING" } },
+    { "ordering across types", "1 < \"a\";", outcome{ err: "1:3: type mismatch: INTEGER < STRING" } },
+    { "null arithmetic", "first([]) + 1;", outcome{ err: "1:11: type mismatch: NULL + INTEGER" } },
+    { "null ordering", "first([]) < first([]);", outcome{ err: "1:11: unknown operator: NULL < NULL" } },
+    { "unknown prefix", "-true;", outcome{ err: "1:1: unknown operator: -BOOLEAN" } },
+    { "division by zero", "10 / 0;", outcome{ err: "1:4: division by zero: 10 / 0" } },
+    { "add overflow", "9223372036854775807 + 1;", outcome{ err: "1:21: integer overflow: 9223372036854775807 + 1" } },
+    { "sub overflow", "-9223372036854775807 - 2;", outcome{ err: "1:22: integer overflow: -9223372036854775807 - 2" } },
+    { "mul overflow", "4611686018427387904 * 2;", outcome{ err: "1:21: integer overflow: 4611686018427387904 * 2" } },
+    { "div overflow", "let min = -9223372036854775807 - 1; min / -1;", outcome{ err: "1:41: integer overflow: -9223372036854775808 / -1" } },
+    { "negate overflow", "let min = -9223372036854775807 - 1; -min;", outcome{ err: "1:37: integer overflow: -(-9223372036854775808)" } },
+    { "overflow in function", "let f = fn(n) { n * n }; f(3037000500);", outcome{ err: "1:19: integer overflow: 3037000500 * 3037000500" } },
+    { "unbound", "foo;", outcome{ err: "identifier not found: foo" } },
+    { "bound too late", "let f = fn() { g }; f(); let g = 1;", outcome{ err: "identifier not found: g" } },
+    { "bound in untaken branch", "let f = fn(c) { if (c) { let y = 1; }; y }; f(false);", outcome{ err: "identifier not found: y" } },
+    { "not a function", "let x = 5; x();", outcome{ err: "not a function: INTEGER" } },
+    { "arity", "fn(a, b) { a }(1);", outcome{ err: "wrong number of arguments: want=2, got=1" } },
+    { "builtin error", "rest(1);", outcome{ err: "argument to `rest` must be ARRAY, got INTEGER" } },
+    { "bad index", "1[0];", outcome{ err: "index operator not supported: INTEGER[INTEGER]" } },
+    { "bad hash key", "{}[fn() {}];", outcome{ err: "unusable as hash key: FUNCTION" } },
+    { "error in function", "let f = fn() { 1 + \"a\" }; f(); 5;", outcome{ err: "1:18: type mismatch: INTEGER + STRING" } },
+    { "error stops the program", "log(1); -\"a\"; log(2);", outcome{ err: "1:9: unknown operator: -STRING", log: []string{ "1" } } },
+    { "error stops arguments", "fn(a, b) { a }(log(1), 1 + true, log(2));", outcome{ err: "1:26: type mismatch: INTEGER + BOOLEAN", log: []string{ "1" } } },
+    { "duplicate parameters", "let f = fn(a, a) { a }; f(1, 2);", outcome{ err: "1:15: duplicate parameter 'a'" } },
+    { "bad key after values", "{log(\"k\"): log(\"v\"), []: log(\"w\")};", outcome{ err: "unusable as hash key: ARRAY", log: []string{ "k", "v", "w" } } },
+}
+
+func TestDifferential(t *testing.T) {
+    var trace []string
+    registerLog(t, &trace)
+
+    for _,test := range differentialCorpus {
+        t.Run(test.name, func(t *testing.T) {
+            l := lexer.New([]byte(test.input))
+            p := parser.New(&l)
+            program,errs := p.ParseProgram()
+            if len(errs) > 0 {
+                got := outcome{ err: errs[0].Error() }
+                if !sameOutcome(got, test.expected) {
+                    t.Fatalf("parse: %s\nExpected:%+v\ngot:%+v", test.input, test.expected, got)
+                }
+                return
+            }
+
+            engines := []struct {
+                name string
+                run func() outcome
+            } {
+                { "eval", func() outcome { return runEvaluator(program) } },
+                { "vm", func() outcome { return runCompiled(program) } },
+            }
+            for _,engine := range engines {
+                trace = nil
+                got := engine.run()
+                got.log = trace
+                if !sameOutcome(got, test.expected) {
+                    t.Fatalf("%s: %s\nExpected:%+v\ngot:%+v", engine.name, test.input, test.expected, got)
+                }
+            }
+        })
+    }
+}
+
+// limitCorpus lists programs past a limit of the bytecode, such as how
+// many elements an array literal can have. The evaluator has no such
+// limits and must give expected, while the compiler must refuse the
+// program with compileErr rather than encode it wrongly.
+var limitCorpus = []struct {
+    name string
+    input string
+    expected outcome
+    compileErr string
+}{
+    { "array elements", "len([" + repeatList("true", 70001) + "]);", outcome{ value: "70001" }, "1:5: too many elements" },
+    { "hash pairs", "len(rest([{" + hashPairs(32768) + "}]));", outcome{ value: "0" }, "1:11: too many pairs" },
+    { "globals", globalLets(65540) + "v3;", outcome{ value: "true" }, "65537:1: too many global bindings" },
+}
+
+// repeatList joins n copies of elem into a list.
+func repeatList(elem string, n int) string {
+    return strings.TrimSuffix(strings.Repeat(elem + ", ", n), ", ")
+}
+
+func hashPairs(n int) string {
+    pairs := make([]string, n)
+    for i := range pairs {
+        pairs[i] = fmt.Sprintf("%d: true", i)
+    }
+    return strings.Join(pairs, ", ")
+}
+
+// globalLets binds n globals, v0 and up, to true, except the last which
+// is false.
+func globalLets(n int) string {
+    var sb strings.Builder
+    for i := 0; i < n; i++ {
+        fmt.Fprintf(&sb, "let v%d = %t;\n", i, i != n-1)
+    }
+    return sb.String()
+}
+
+func TestDifferentialLimits(t *testing.T) {
+    for _,test := range limitCorpus {
+        t.Run(test.name, func(t *testing.T) {
+            l := lexer.New([]byte(test.input))
+            p := parser.New(&l)
+            program,errs := p.ParseProgram()
+            if len(errs) > 0 {
+                t.Fatalf("could not parse (%s)", errs[0])
+            }
+            if got := runEvaluator(program); !sameOutcome(got, test.expected) {
+                t.Fatalf("eval: Expected:%+v got:%+v", test.expected, got)
+            }
+            expected := outcome{ err: test.compileErr }
+            if got := runCompiled(program); !sameOutcome(got, expected) {
+                t.Fatalf("vm: Expected:%+v got:%+v", expected, got)
+            }
+        })
+    }
+}
+
+func runEvaluator(program *ast.Program) outcome {
+    res := evaluator.Eval(program, object.NewEnvironment())
+    if e,ok := res.(*object.Error); ok {
+        return outcome{ err: e.Error() }
+    }
+    return outcome{ value: res.Inspect() }
+}
+
+func runCompiled(program *ast.Program) outcome {
+    c := compiler.New()
+    if err := c.Compile(program); err != nil {
+        return outcome{ err: err.Error() }
+    }
+    machine := New(c.Bytecode())
+    if err := machine.Run(); err != nil {
+        return outcome{ err: err.Error() }
+    }
+    return outcome{ value: machine.LastPoppedStackElem().Inspect() }
+}
+
+func sameOutcome(a outcome, b outcome) bool {
+    if a.value != b.value || a.err != b.err || len(a.log) != len(b.log) {
+        return false
+    }
+    for i := range a.log {
+        if a.log[i] != b.log[i] {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,30 @@
+package vm
+
+import (
+	"interpreter/code"
+	"interpreter/object"
+)
+
+// Frame is one function call in progress. basePointer is the height of
+// the stack when it was called, with the function and its arguments
+// popped, which is where its result goes.
+type Frame struct {
+    cl *object.Closure
+    ip int
+    basePointer int
+    // locals is nil for the program itself, whose bindings are globals
+    locals *object.Locals
+}
+
+func NewFrame(cl *object.Closure, basePointer int, locals *object.Locals) *Frame {
+    return &Frame{
+        cl: cl,
+        ip: -1,
+        basePointer: basePointer,
+        locals: locals,
+    }
+}
+
+func (f *Frame) Instructions() code.Instructions {
+    return f.cl.Fn.Instructions
+}
@@ -0,0 +1,330 @@
+// Package vm runs the bytecode made by the compiler. It aims to give a
+// program the same result and the same runtime errors as the tree
+// evaluator, and differential_test.go checks the two against a shared
+// corpus. The compiler and the vm have limits of their own that the
+// evaluator doesn't share, such as 256 locals per function and StackSize
+// values on the stack at once, and only the evaluator can be stopped by a
+// context.
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/object"
+)
+
+const (
+    StackSize = 2048
+    GlobalsSize = 65536
+    // MaxFrames bounds the function calls in progress at once, not counting
+    // the program itself.
+    MaxFrames = object.MaxCallDepth
+)
+
+type VM struct {
+    constants []object.Object
+    globals []object.Object
+    globalNames []string
+
+    stack []object.Object
+    // sp points at the next free slot, so the top is stack[sp-1]
+    sp int
+
+    frames []*Frame
+    framesIndex int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+    main := &object.Closure{ Fn: &object.CompiledFunction{
+        Instructions: bytecode.Instructions,
+        Operators: bytecode.Operators,
+    } }
+    frames := make([]*Frame, MaxFrames+1)
+    frames[0] = NewFrame(main, 0, nil)
+
+    return &VM{
+        constants: bytecode.Constants,
+        globals: make([]object.Object, GlobalsSize),
+        globalNames: bytecode.Globals,
+        stack: make([]object.Object, StackSize),
+        sp: 0,
+        frames: frames,
+        framesIndex: 1,
+    }
+}
+
+// LastPoppedStackElem is the value of the last statement run, which is
+// the result of the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+    if vm.stack[vm.sp] == nil {
+        return object.NULL
+    }
+    return vm.stack[vm.sp]
+}
+
+var infixOperators = map[code.Opcode]string {
+    code.Op_add: "+",
+    code.Op_sub: "-",
+    code.Op_mul: "*",
+    code.Op_div: "/",
+    code.Op_equal: "==",
+    code.Op_notEqual: "!=",
+    code.Op_lessThan: "<",
+    code.Op_greaterThan: ">",
+}
+
+// Run executes the program until it ends, returns at the top level, or
+// fails. Runtime errors are worded the way the evaluator words them.
+func (vm *VM) Run() error {
+    for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+        frame := vm.currentFrame()
+        frame.ip++
+        ip := frame.ip
+        ins := frame.Instructions()
+        op := code.Opcode(ins[ip])
+
+        var err error
+        switch op {
+            case code.Op_constant: {
+                index := code.ReadUint16(ins[ip+1:])
+                frame.ip += 2
+                err = vm.push(vm.constants[index])
+            }
+            case code.Op_pop: vm.pop()
+            case code.Op_true: err = vm.push(object.TRUE)
+            case code.Op_false: err = vm.push(object.FALSE)
+            case code.Op_null: err = vm.push(object.NULL)
+
+            case code.Op_add, code.Op_sub, code.Op_mul, code.Op_div,
+                code.Op_equal, code.Op_notEqual, code.Op_lessThan, code.Op_greaterThan: {
+                right := vm.pop()
+                left := vm.pop()
+                err = vm.pushResult(object.ApplyInfix(infixOperators[op], left, right))
+            }
+            case code.Op_minus: err = vm.pushResult(object.ApplyPrefix("-", vm.pop()))
+            case code.Op_bang: err = vm.pushResult(object.ApplyPrefix("!", vm.pop()))
+
+            case code.Op_jump: {
+                pos := int(code.ReadUint16(ins[ip+1:]))
+                frame.ip = pos - 1
+            }
+            case code.Op_jumpNotTruthy: {
+                pos := int(code.ReadUint16(ins[ip+1:]))
+                frame.ip += 2
+                if !object.IsTruthy(vm.pop()) {
+                    frame.ip = pos - 1
+                }
+            }
+
+            case code.Op_getGlobal: {
+                index := code.ReadUint16(ins[ip+1:])
+                frame.ip += 2
+                val,gerr := vm.global(int(index))
+                if gerr != nil {
+                    return gerr
+                }
+                err = vm.push(val)
+            }
+            case code.Op_setGlobal: {
+                index := code.ReadUint16(ins[ip+1:])
+                frame.ip += 2
+                vm.globals[index] = vm.pop()
+            }
+            case code.Op_getLocal: {
+                index := code.ReadUint8(ins[ip+1:])
+                frame.ip += 1
+                err = vm.push(frame.locals.Slots[index])
+            }
+            case code.Op_setLocal: {
+                index := code.ReadUint8(ins[ip+1:])
+                frame.ip += 1
+                frame.locals.Slots[index] = vm.pop()
+            }
+            case code.Op_getName: {
+                index := code.ReadUint16(ins[ip+1:])
+                frame.ip += 2
+                val,nerr := vm.name(frame, frame.cl.Fn.Refs[index])
+                if nerr != nil {
+                    return nerr
+                }
+                err = vm.push(val)
+            }
+
+            case code.Op_array: {
+                n := int(code.ReadUint16(ins[ip+1:]))
+                frame.ip += 2
+                elems := make([]object.Object, n)
+                copy(elems, vm.stack[vm.sp-n:vm.sp])
+                vm.sp -= n
+                err = vm.push(&object.Array{ Elements: elems })
+            }
+            case code.Op_hash: {
+                n := int(code.ReadUint16(ins[ip+1:]))
+                frame.ip += 2
+                hash,herr := vm.buildHash(vm.sp-n, vm.sp)
+                if herr != nil {
+                    return herr
+                }
+                vm.sp -= n
+                err = vm.push(hash)
+            }
+            case code.Op_index: {
+                index := vm.pop()
+                left := vm.pop()
+                err = vm.pushResult(object.ApplyIndex(left, index))
+            }
+
+            case code.Op_closure: {
+                index := code.ReadUint16(ins[ip+1:])
+                frame.ip += 2
+                fn := vm.constants[index].(*object.CompiledFunction)
+                err = vm.push(&object.Closure{ Fn: fn, Outer: frame.locals })
+            }
+            case code.Op_call: {
+                argc := int(code.ReadUint8(ins[ip+1:]))
+                frame.ip += 1
+                err = vm.call(argc)
+            }
+            case code.Op_returnValue: {
+                ret := vm.pop()
+                if vm.framesIndex == 1 {
+                    // a return at the top level ends the program, and the
+                    // value just popped is its result
+                    return nil
+                }
+                frame := vm.popFrame()
+                vm.sp = frame.basePointer
+                err = vm.push(ret)
+            }
+
+            default: return fmt.Errorf("unknown opcode %d", op)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// call calls the function sitting below its argc arguments on the stack.
+func (vm *VM) call(argc int) error {
+    callee := vm.stack[vm.sp-1-argc]
+    switch callee := callee.(type) {
+        case *object.Closure: {
+            fn := callee.Fn
+            if argc != len(fn.Parameters) {
+                return fmt.Errorf("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), argc)
+            }
+            if vm.framesIndex > MaxFrames {
+                return errors.New("stack overflow")
+            }
+            // the parameters are bound to the arguments, and every other
+            // local is unbound until its let runs
+            locals := &object.Locals{ Slots: make([]object.Object, len(fn.Locals)), Outer: callee.Outer }
+            copy(locals.Slots, vm.stack[vm.sp-argc:vm.sp])
+            vm.sp -= argc + 1
+            vm.pushFrame(NewFrame(callee, vm.sp, locals))
+            return nil
+        }
+        case *object.Builtin: {
+            args := make([]object.Object, argc)
+            copy(args, vm.stack[vm.sp-argc:vm.sp])
+            res := callee.Fn(args...)
+            vm.sp -= argc + 1
+            if res == nil {
+                res = object.NULL
+            }
+            return vm.pushResult(res)
+        }
+    }
+    return fmt.Errorf("not a function: %s", callee.Type())
+}
+
+// name reads a name through its ref, from the first enclosing call that
+// has it bound, or else from its global.
+func (vm *VM) name(frame *Frame, ref object.Ref) (object.Object, error) {
+    for _,slot := range ref.Slots {
+        locals := frame.locals
+        for i := 0; i < slot.Depth; i++ {
+            locals = locals.Outer
+        }
+        if val := locals.Slots[slot.Index]; val != nil {
+            return val, nil
+        }
+    }
+    return vm.global(ref.Global)
+}
+
+// global reads a global slot. An unbound global falls back to the builtin
+// of the same name, so a script's own binding always wins over a builtin.
+func (vm *VM) global(index int) (object.Object, error) {
+    if val := vm.globals[index]; val != nil {
+        return val, nil
+    }
+    if builtin,ok := object.LookupBuiltin(vm.globalNames[index]); ok {
+        return builtin, nil
+    }
+    return nil, fmt.Errorf("identifier not found: %s", vm.globalNames[index])
+}
+
+func (vm *VM) buildHash(start int, end int) (*object.Hash, error) {
+    pairs := make(map[object.HashKey]object.HashPair, (end-start)/2)
+    for i := start; i < end; i += 2 {
+        key := vm.stack[i]
+        hashable,ok := key.(object.Hashable)
+        if !ok {
+            return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+        }
+        pairs[hashable.HashKey()] = object.HashPair{ Key: key, Value: vm.stack[i+1] }
+    }
+    return &object.Hash{ Pairs: pairs }, nil
+}
+
+// stack {{{
+func (vm *VM) push(obj object.Object) error {
+    if vm.sp >= StackSize {
+        return errors.New("stack overflow")
+    }
+    vm.stack[vm.sp] = obj
+    vm.sp++
+    return nil
+}
+
+// pushResult pushes the result of an operation, or fails with it if it is
+// an error object. An error raised by an operator is located at the
+// operator's token, as the evaluator does.
+func (vm *VM) pushResult(obj object.Object) error {
+    if e,ok := obj.(*object.Error); ok {
+        frame := vm.currentFrame()
+        if tok,ok := frame.cl.Fn.Operators[frame.ip]; ok {
+            object.Locate(e, tok)
+        }
+        return e
+    }
+    return vm.push(obj)
+}
+
+func (vm *VM) pop() object.Object {
+    obj := vm.stack[vm.sp-1]
+    vm.sp--
+    return obj
+}
+// }}}
+
+// frames {{{
+func (vm *VM) currentFrame() *Frame {
+    return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+    vm.frames[vm.framesIndex] = f
+    vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+    vm.framesIndex--
+    return vm.frames[vm.framesIndex]
+}
+// }}}
@@ -0,0 +1,177 @@
+package vm
+
+import (
+	"interpreter/compiler"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+func testRun(t *testing.T, input string) (object.Object, error) {
+    t.Helper()
+    l := lexer.New([]byte(input))
+    p := parser.New(&l)
+    program,errs := p.ParseProgram()
+    if len(errs) > 0 {
+        t.Fatalf("could not parse:%s (%s)", input, errs[0])
+    }
+    c := compiler.New()
+    if err := c.Compile(program); err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+    machine := New(c.Bytecode())
+    if err := machine.Run(); err != nil {
+        return nil, err
+    }
+    return machine.LastPoppedStackElem(), nil
+}
+
+// vmTest gives the expected result as it would be inspected.
+type vmTest struct {
+    input string
+    expected string
+}
+
+func runVMTests(t *testing.T, tests []vmTest) {
+    t.Helper()
+    for _,test := range tests {
+        res,err := testRun(t, test.input)
+        if err != nil {
+            t.Fatalf("%s: vm error: %s", test.input, err)
+        }
+        if res.Inspect() != test.expected {
+            t.Fatalf("%s: Expected:%s got:%s", test.input, test.expected, res.Inspect())
+        }
+    }
+}
+
+func TestExpressions(t *testing.T) {
+    runVMTests(t, []vmTest{
+        { "", "null" },
+        { "1 + 2;", "3" },
+        { "(5 + 10 * 2 + 15 / 3) * 2 + -10;", "50" },
+        { "1 < 2 == true; ", "true" },
+        { "!(2 > 1) != !!5;", "true" },
+        { "\"mon\" + \"key\" == \"monkey\";", "true" },
+        { "[1, 2 * 2, \"x\"][1];", "4" },
+        { "[1, 2][2];", "null" },
+        { "{\"a\": 1, true: 2}[true];", "2" },
+        { "{}[\"missing\"];", "null" },
+    })
+}
+
+func TestGlobalsAndReturns(t *testing.T) {
+    runVMTests(t, []vmTest{
+        { "let a = 5; let b = a * 2; b;", "10" },
+        { "let a = 5;", "5" },
+        { "let a = 1; let a = a + 1; a;", "2" },
+        { "return 1; 2;", "1" },
+        { "if (true) { return 3; } 4;", "3" },
+    })
+}
+
+func TestConditionals(t *testing.T) {
+    runVMTests(t, []vmTest{
+        { "if (true) { 10 };", "10" },
+        { "if (false) { 10 };", "null" },
+        { "if (1 > 2) { 10 } else { 20 };", "20" },
+        { "if ([][0]) { 1 } else { 2 };", "2" },
+        { "if (true) { let x = 3; };", "3" },
+        { "if (true) {};", "null" },
+        { "if ((if (false) { 1 })) { 1 } else { 2 };", "2" },
+    })
+}
+
+func TestFunctions(t *testing.T) {
+    runVMTests(t, []vmTest{
+        { "let f = fn() { 5 + 10 }; f();", "15" },
+        { "let f = fn() {}; f();", "null" },
+        { "let f = fn() { return 1; 2 }; f();", "1" },
+        { "let f = fn(a, b) { let c = a + b; c * 2 }; f(1, 2) + f(3, 4);", "20" },
+        { "let f = fn(x) { let y = x; }; f(7);", "7" },
+        { "let one = fn() { 1 }; let two = fn() { one() + one() }; two();", "2" },
+        { "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15);", "610" },
+        { "let g = 10; let f = fn() { let g = g + 1; g }; [f(), g];", "[11, 10]" },
+        { "fn(x) { x }(3);", "3" },
+        { "len(\"four\") + len(rest([1, 2, 3]));", "6" },
+        { "let f = fn() { len }; let len = 5; f();", "5" },
+        { "let f = fn() { len }; let a = f(); let len = 5; [a(\"ab\"), f()];", "[2, 5]" },
+        { "let f = fn(x) { x }; f;", "fn(x) {expression stmt:: value:x}" },
+    })
+}
+
+func TestClosures(t *testing.T) {
+    runVMTests(t, []vmTest{
+        { "let adder = fn(x) { fn(y) { x + y } }; let add2 = adder(2); add2(3);", "5" },
+        { "let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3);", "6" },
+        { "let f = fn(a) { let b = a * 2; fn() { let c = 3; fn() { a + b + c } } }; f(1)()();", "6" },
+        { "let g = 10; let f = fn(a) { fn() { a + g } }; f(1)();", "11" },
+        { "let f = fn() { let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(5) }; f();", "5" },
+        { "let f = fn(x) { let x = fn() { x }; x }; f(1)()();", "fn() {expression stmt:: value:x}" },
+        { "let c = fn() { let n = 0; let inc = fn() { n + 1 }; let n = 10; inc() }; c();", "11" },
+        { "let f = fn() { let a = fn(n) { if (n == 0) { 0 } else { b(n - 1) } }; let b = fn(n) { a(n) }; a(3) }; f();", "0" },
+        { "let f = fn(c) { let g = fn() { x }; if (c) { let x = 1; }; g() }; let x = 2; [f(true), f(false)];", "[1, 2]" },
+        { "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1023);", "1023" },
+    })
+}
+
+func TestRuntimeErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { "1 + true;", "1:3: type mismatch: INTEGER + BOOLEAN" },
+        { "-\"a\";", "1:1: unknown operator: -STRING" },
+        { "true * false;", "1:6: unknown operator: BOOLEAN * BOOLEAN" },
+        { "let f = fn(x) {\n  x / 0\n}; f(1);", "2:5: division by zero: 1 / 0" },
+        { "9223372036854775807 + 1;", "1:21: integer overflow: 9223372036854775807 + 1" },
+        { "x;", "identifier not found: x" },
+        { "let f = fn() { y }; f(); let y = 1;", "identifier not found: y" },
+        { "let f = fn(c) { if (c) { let z = 1; }; z }; f(false);", "identifier not found: z" },
+        { "5();", "not a function: INTEGER" },
+        { "fn(a) { a }();", "wrong number of arguments: want=1, got=0" },
+        { "len(1);", "argument to `len` must be STRING or ARRAY, got INTEGER" },
+        { "1[0];", "index operator not supported: INTEGER[INTEGER]" },
+        { "{[1]: 2};", "unusable as hash key: ARRAY" },
+        { "let f = fn() { f() }; f();", "stack overflow" },
+        { "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(1024);", "stack overflow" },
+        // more values at once than the stack holds
+        { "len([" + strings.Repeat("1, ", StackSize) + "1]);", "stack overflow" },
+    }
+
+    for _,test := range tests {
+        _,err := testRun(t, test.input)
+        if err == nil {
+            t.Fatalf("%s: Expected error:%s", test.input, test.expected)
+        }
+        if err.Error() != test.expected {
+            t.Fatalf("%s: Expected error:%s got:%s", test.input, test.expected, err)
+        }
+    }
+}
+
+// TestCompileLimits checks that a program too large for its operands to
+// be encoded fails to compile, rather than running with them truncated.
+func TestCompileLimits(t *testing.T) {
+    tests := []struct {
+        input string
+        expected string
+    } {
+        { strings.Repeat("true;", 40000) + "if (false) { 1 } else { 2 };", "1:200001: operand 0 of Op_jumpNotTruthy out of range: 80010" },
+    }
+
+    for _,test := range tests {
+        l := lexer.New([]byte(test.input))
+        p := parser.New(&l)
+        program,errs := p.ParseProgram()
+        if len(errs) > 0 {
+            t.Fatalf("could not parse (%s)", errs[0])
+        }
+        err := compiler.New().Compile(program)
+        if err == nil || err.Error() != test.expected {
+            t.Fatalf("Expected compiler error:%s got:%v", test.expected, err)
+        }
+    }
+}